@@ -0,0 +1,279 @@
+package bet
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"oracle"
+	"script"
+	"strings"
+	"unicode"
+)
+
+const (
+	FieldTemperature   = "temperature"
+	FieldPrecipitation = "precipitation"
+)
+
+var (
+	ErrNoOutcomes       = errors.New("contract has no outcomes")
+	ErrMisplacedDefault = errors.New("only the last outcome may match any value")
+	ErrNoRefund         = errors.New("contract has no refund path")
+	ErrNoWinner         = errors.New("value matches no outcome")
+	ErrBadPredicate     = errors.New("predicate is not a comparison with numbers")
+	ErrBadObservation   = errors.New("observation fields must be single script tokens")
+)
+
+// Party is identified by the hash of its base64 PEM public key, the same way
+// the genesis script locks its output.
+type Party struct {
+	PubKeyHash string
+}
+
+func NewParty(pubKey string) Party {
+	return Party{PubKeyHash: script.OPHash(pubKey)}
+}
+
+// Observation is the oracle attestation a contract settles on.
+type Observation struct {
+	Oracle    string
+	Station   string
+	Field     string
+	Timestamp int64
+}
+
+// Outcome pays Winner when Predicate holds for the attested value. Predicate
+// is a script fragment replacing the value with a boolean, built with Above,
+// Below or Between. An empty Predicate matches any value.
+type Outcome struct {
+	Predicate string
+	Winner    Party
+}
+
+// Refund lets Party take the funds back once the spending transaction's lock
+// time reaches Timeout, a block height or unix time, if nobody claimed them.
+type Refund struct {
+	Party   Party
+	Timeout int64
+}
+
+type Contract struct {
+	Observation Observation
+	Outcomes    []Outcome
+	Refund      Refund
+}
+
+type Bucket struct {
+	Min, Max string
+	Winner   Party
+}
+
+// Above matches values strictly greater than threshold.
+func Above(threshold string) string {
+	return threshold + " OPGreaterThan"
+}
+
+// Below matches values strictly lower than threshold.
+func Below(threshold string) string {
+	return threshold + " OPLessThan"
+}
+
+// Between matches values in [min, max).
+func Between(min, max string) string {
+	return min + " " + max + " OPWithin"
+}
+
+// TemperatureAbove pays above if the temperature at the observed station
+// and time exceeds threshold, below otherwise.
+func TemperatureAbove(obs Observation, threshold string, above, below Party, refund Refund) Contract {
+	obs.Field = FieldTemperature
+	return Contract{
+		Observation: obs,
+		Outcomes:    []Outcome{{Predicate: Above(threshold), Winner: above}, {Winner: below}},
+		Refund:      refund,
+	}
+}
+
+// Rain pays yes if any precipitation was observed, no otherwise.
+func Rain(obs Observation, yes, no Party, refund Refund) Contract {
+	return PrecipitationAbove(obs, "0", yes, no, refund)
+}
+
+// PrecipitationAbove pays above if more than threshold millimeters of
+// precipitation were observed, below otherwise.
+func PrecipitationAbove(obs Observation, threshold string, above, below Party, refund Refund) Contract {
+	obs.Field = FieldPrecipitation
+	return Contract{
+		Observation: obs,
+		Outcomes:    []Outcome{{Predicate: Above(threshold), Winner: above}, {Winner: below}},
+		Refund:      refund,
+	}
+}
+
+// Range pays the winner of the bucket the observed value falls in. Values
+// outside every bucket can only be refunded.
+func Range(obs Observation, buckets []Bucket, refund Refund) Contract {
+	contract := Contract{Observation: obs, Refund: refund}
+	for _, bucket := range buckets {
+		contract.Outcomes = append(contract.Outcomes, Outcome{Predicate: Between(bucket.Min, bucket.Max), Winner: bucket.Winner})
+	}
+	return contract
+}
+
+func (c Contract) Validate() error {
+	if len(c.Outcomes) == 0 {
+		return ErrNoOutcomes
+	}
+	for idx, outcome := range c.Outcomes {
+		if outcome.Predicate == "" {
+			if idx != len(c.Outcomes)-1 {
+				return ErrMisplacedDefault
+			}
+			continue
+		}
+		if err := checkPredicate(outcome.Predicate); err != nil {
+			return fmt.Errorf("outcome %d: %w", idx, err)
+		}
+	}
+	if err := c.Refund.validate(); err != nil {
+		return err
+	}
+
+	obs := c.Observation
+	for _, field := range []string{obs.Oracle, obs.Station, obs.Field} {
+		if field == "" || strings.ContainsFunc(field, unicode.IsSpace) {
+			return fmt.Errorf("%w: %q", ErrBadObservation, field)
+		}
+	}
+
+	return nil
+}
+
+// checkPredicate accepts the predicates of Above, Below and Between, with
+// bounds the script can compare and a non-empty bucket.
+func checkPredicate(predicate string) error {
+	tokens := strings.Fields(predicate)
+	operands := map[string]int{"OPGreaterThan": 1, "OPLessThan": 1, "OPWithin": 2}
+	if len(tokens) == 0 || len(tokens) != operands[tokens[len(tokens)-1]]+1 {
+		return fmt.Errorf("%w: %q", ErrBadPredicate, predicate)
+	}
+
+	var bounds []*big.Rat
+	for _, token := range tokens[:len(tokens)-1] {
+		number, err := script.ParseNumber(token)
+		if err != nil {
+			return fmt.Errorf("%w: %w", ErrBadPredicate, err)
+		}
+		bounds = append(bounds, number)
+	}
+	if len(bounds) == 2 && bounds[0].Cmp(bounds[1]) >= 0 {
+		return fmt.Errorf("%w: empty range %q", ErrBadPredicate, predicate)
+	}
+
+	return nil
+}
+
+// LockingScript checks the outcomes in order when claimed, and the refund
+// path otherwise:
+//
+//	claim OPDup OPIf
+//	  <attested value> <predicate> OPIf <pay winner> OPElse ... OPEndIf
+//	OPElse
+//	  <timeout> OPCheckLockTimeVerify OPDrop <pay refund>
+//	OPEndIf <signature check>
+func (c Contract) LockingScript() (string, error) {
+	if err := c.Validate(); err != nil {
+		return "", err
+	}
+
+	obs := c.Observation
+	condition := oracle.Condition(obs.Oracle, oracle.ObservationID(obs.Oracle, obs.Station, obs.Field, obs.Timestamp))
+
+	tokens := []string{"sign pubKey claim sig value --- claim OPDup OPIf"}
+	opened := 0
+	for _, outcome := range c.Outcomes {
+		if outcome.Predicate == "" {
+			tokens = append(tokens, payTo(outcome.Winner))
+			break
+		}
+
+		tokens = append(tokens, condition, outcome.Predicate, "OPIf", payTo(outcome.Winner), "OPElse")
+		opened++
+	}
+	if c.Outcomes[len(c.Outcomes)-1].Predicate != "" {
+		tokens = append(tokens, "0 OPVerify")
+	}
+	for ; opened > 0; opened-- {
+		tokens = append(tokens, "OPEndIf")
+	}
+
+	tokens = append(tokens, c.Refund.script())
+
+	return strings.Join(tokens, " "), nil
+}
+
+// Address is the pay-to-script-hash address of the locking script. Funding
+// script.PayToScriptHash(address) keeps the contract out of the UTXO set
+// until it is spent, with the locking script in script.RedeemArgs.
+func (c Contract) Address() (string, error) {
+	lockingScript, err := c.LockingScript()
+	if err != nil {
+		return "", err
+	}
+	return script.OPHash(lockingScript), nil
+}
+
+func payTo(p Party) string {
+	return "pubKey OPDup OPHash " + p.PubKeyHash + " OPEqualVerify"
+}
+
+func (r Refund) validate() error {
+	if r.Party.PubKeyHash == "" || r.Timeout <= 0 {
+		return ErrNoRefund
+	}
+	return nil
+}
+
+// script closes the claim branch of a locking script with the refund path and
+// the signature check both paths end with.
+func (r Refund) script() string {
+	return strings.Join([]string{
+		"OPElse", fmt.Sprint(r.Timeout), "OPCheckLockTimeVerify OPDrop", payTo(r.Party), "OPEndIf",
+		"sign OPDup pubKey OPDup OPCheckSig",
+	}, " ")
+}
+
+// Winner returns the party the contract pays for an attested value.
+func (c Contract) Winner(value string) (Party, error) {
+	for _, outcome := range c.Outcomes {
+		if outcome.Predicate == "" {
+			return outcome.Winner, nil
+		}
+
+		err := script.EvalScript("--- "+value+" "+outcome.Predicate, script.Context{})
+		if err == nil {
+			return outcome.Winner, nil
+		}
+		if !errors.Is(err, script.ErrEvalFalse) {
+			return Party{}, err
+		}
+	}
+
+	return Party{}, fmt.Errorf("%w: %s", ErrNoWinner, value)
+}
+
+// ClaimArgs unlocks the contract for the winner of attestation, signing with
+// the key of pubKey.
+func ClaimArgs(attestation oracle.Attestation, pubKey, signature string) map[string]string {
+	args := attestation.ScriptArgs()
+	args["claim"] = "1"
+	args["pubKey"] = pubKey
+	args["sign"] = signature
+	return args
+}
+
+// RefundArgs unlocks the refund path. The spending transaction must have a
+// lock time of at least the contract's Timeout, of the same kind.
+func RefundArgs(pubKey, signature string) map[string]string {
+	return map[string]string{"claim": "0", "pubKey": pubKey, "sign": signature}
+}
@@ -0,0 +1,387 @@
+package bet_test
+
+import (
+	"bet"
+	"blockchain"
+	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"oracle"
+	"script"
+	"strconv"
+	"testing"
+)
+
+// timeout is a block height, reached once two blocks follow the genesis.
+const timeout = 2
+
+type wallet struct {
+	key    *rsa.PrivateKey
+	pubKey string
+}
+
+func newWallet(t *testing.T) wallet {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	return wallet{key: key, pubKey: base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))}
+}
+
+func (w wallet) party() bet.Party {
+	return bet.NewParty(w.pubKey)
+}
+
+func (w wallet) sign(t *testing.T, chain *blockchain.BlockChain, transaction blockchain.Transaction) string {
+	digest, err := chain.SignatureHash(transaction, 0, script.SigHashAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := rsa.SignPKCS1v15(nil, w.key, crypto.SHA256, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return script.EncodeSignature(signature, script.SigHashAll)
+}
+
+type betFixture struct {
+	chain        blockchain.BlockChain
+	attestation  oracle.Attestation
+	contract     bet.Contract
+	redeemScript string
+}
+
+func newFixture(t *testing.T, value string, contract func(bet.Observation) bet.Contract) betFixture {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	o := oracle.New(key, oracle.NewMemoryStore())
+
+	obs := bet.Observation{Oracle: o.PublicKey(), Station: "LFPG", Timestamp: 1700000000}
+	c := contract(obs)
+
+	attestation, err := o.Attest(oracle.Observation{Station: "LFPG", Field: c.Observation.Field, Value: value, Timestamp: 1700000000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	lockingScript, err := c.LockingScript()
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := blockchain.NewGenesisBlock([]blockchain.Transaction{
+		blockchain.NewTransaction(nil, []blockchain.TransactionOutput{{Value: 100, Script: lockingScript}}),
+	})
+
+	return betFixture{chain: blockchain.NewChain(genesis), attestation: attestation, contract: c}
+}
+
+// spend pays the bet output to w, unlocked with the arguments args returns
+// for w's signature.
+func (f *betFixture) spend(t *testing.T, w wallet, lockTime int64, args func(signature string) map[string]string) error {
+	input := blockchain.TransactionInput{TXID: f.chain.GenesisBlock.Transactions[0].TXID, VOUT: 0}
+	transaction := blockchain.NewLockedTransaction([]blockchain.TransactionInput{input}, []blockchain.TransactionOutput{{Value: 100, Script: "payout"}}, lockTime)
+
+	transaction.Inputs[0].ScriptArgs = args(w.sign(t, &f.chain, transaction))
+	if f.redeemScript != "" {
+		transaction.Inputs[0].ScriptArgs = script.RedeemArgs(f.redeemScript, transaction.Inputs[0].ScriptArgs)
+	}
+	transaction.TXID = transaction.Hash()
+
+	return f.chain.CheckTransaction(transaction)
+}
+
+// payToScriptHash funds the contract through its address instead.
+func (f *betFixture) payToScriptHash(t *testing.T) {
+	address, err := f.contract.Address()
+	if err != nil {
+		t.Fatal(err)
+	}
+	f.redeemScript, _ = f.contract.LockingScript()
+
+	genesis := blockchain.NewGenesisBlock([]blockchain.Transaction{
+		blockchain.NewTransaction(nil, []blockchain.TransactionOutput{{Value: 100, Script: script.PayToScriptHash(address)}}),
+	})
+	f.chain = blockchain.NewChain(genesis)
+}
+
+func (f *betFixture) mine(t *testing.T, blocks int) {
+	for i := 0; i < blocks; i++ {
+		block := f.chain.NewCandidateBlock(nil)
+		for !block.IsValid() {
+			block.Header.Nonce++
+		}
+		if _, err := f.chain.ProcessBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func (f *betFixture) claim(t *testing.T, w wallet) error {
+	return f.spend(t, w, 0, func(signature string) map[string]string {
+		return bet.ClaimArgs(f.attestation, w.pubKey, signature)
+	})
+}
+
+func (f *betFixture) refund(t *testing.T, w wallet, lockTime int64) error {
+	return f.spend(t, w, lockTime, func(signature string) map[string]string {
+		return bet.RefundArgs(w.pubKey, signature)
+	})
+}
+
+func TestTemperatureAbove(t *testing.T) {
+	alice, bob, carol := newWallet(t), newWallet(t), newWallet(t)
+	contract := func(obs bet.Observation) bet.Contract {
+		return bet.TemperatureAbove(obs, "20", alice.party(), bob.party(), bet.Refund{Party: carol.party(), Timeout: timeout})
+	}
+
+	warm := newFixture(t, "21", contract)
+	if err := warm.claim(t, bob); !errors.Is(err, script.ErrVerifyFailed) {
+		t.Fatalf("Got %v, expected bob's claim to fail at 21 degrees", err)
+	}
+	if err := warm.claim(t, alice); err != nil {
+		t.Fatalf("Got %v, expected alice to win at 21 degrees", err)
+	}
+
+	cold := newFixture(t, "20", contract)
+	if err := cold.claim(t, alice); !errors.Is(err, script.ErrVerifyFailed) {
+		t.Fatalf("Got %v, expected alice's claim to fail at 20 degrees", err)
+	}
+	if err := cold.claim(t, bob); err != nil {
+		t.Fatalf("Got %v, expected bob to win at 20 degrees", err)
+	}
+}
+
+func TestRefundAfterTimeout(t *testing.T) {
+	alice, bob, carol := newWallet(t), newWallet(t), newWallet(t)
+	f := newFixture(t, "0", func(obs bet.Observation) bet.Contract {
+		return bet.Rain(obs, alice.party(), bob.party(), bet.Refund{Party: carol.party(), Timeout: timeout})
+	})
+
+	f.mine(t, timeout)
+
+	if err := f.refund(t, carol, timeout-1); !errors.Is(err, script.ErrUnsatisfiedLockTime) {
+		t.Fatalf("Got %v, expected the refund to wait for the timeout", err)
+	}
+	if err := f.refund(t, alice, timeout); !errors.Is(err, script.ErrVerifyFailed) {
+		t.Fatalf("Got %v, expected only carol to be refunded", err)
+	}
+	if err := f.refund(t, carol, timeout); err != nil {
+		t.Fatalf("Got %v, expected carol to be refunded after the timeout", err)
+	}
+}
+
+func TestRangeBuckets(t *testing.T) {
+	alice, bob, carol := newWallet(t), newWallet(t), newWallet(t)
+	contract := func(obs bet.Observation) bet.Contract {
+		obs.Field = "wind"
+		return bet.Range(obs, []bet.Bucket{
+			{Min: "0", Max: "20", Winner: alice.party()},
+			{Min: "20", Max: "40", Winner: bob.party()},
+		}, bet.Refund{Party: carol.party(), Timeout: timeout})
+	}
+
+	f := newFixture(t, "31", contract)
+	if err := f.claim(t, alice); !errors.Is(err, script.ErrVerifyFailed) {
+		t.Fatalf("Got %v, expected alice's bucket to lose", err)
+	}
+	if err := f.claim(t, bob); err != nil {
+		t.Fatalf("Got %v, expected bob's bucket to win", err)
+	}
+
+	// Nobody wins outside the buckets, the funds can only be refunded.
+	storm := newFixture(t, "55", contract)
+	if err := storm.claim(t, bob); !errors.Is(err, script.ErrVerifyFailed) {
+		t.Fatalf("Got %v, expected no bucket to win", err)
+	}
+	if _, err := storm.contract.Winner("55"); !errors.Is(err, bet.ErrNoWinner) {
+		t.Fatalf("Got %v, expected ErrNoWinner", err)
+	}
+	if winner, err := storm.contract.Winner("19.5"); err != nil || winner != alice.party() {
+		t.Fatalf("Winner(19.5) == %v, %v, expected alice", winner, err)
+	}
+}
+
+func TestContractValidate(t *testing.T) {
+	refund := bet.Refund{Party: bet.Party{PubKeyHash: "refund"}, Timeout: timeout}
+	obs := bet.Observation{Oracle: "oracle", Station: "LFPG", Field: bet.FieldTemperature, Timestamp: 1}
+	tests := map[string]struct {
+		contract bet.Contract
+		err      error
+	}{
+		"no outcomes": {bet.Contract{Refund: refund}, bet.ErrNoOutcomes},
+		"default first": {bet.Contract{
+			Outcomes: []bet.Outcome{{}, {Predicate: bet.Above("1")}},
+			Refund:   refund,
+		}, bet.ErrMisplacedDefault},
+		"no refund": {bet.Contract{Outcomes: []bet.Outcome{{}}}, bet.ErrNoRefund},
+		"bad threshold": {bet.Contract{
+			Observation: obs,
+			Outcomes:    []bet.Outcome{{Predicate: bet.Above("1e3")}, {}},
+			Refund:      refund,
+		}, script.ErrBadEncoding},
+		"injected predicate": {bet.Contract{
+			Observation: obs,
+			Outcomes:    []bet.Outcome{{Predicate: bet.Above("0 OPDrop 1")}, {}},
+			Refund:      refund,
+		}, bet.ErrBadPredicate},
+		"empty bucket": {bet.Range(obs, []bet.Bucket{{Min: "20", Max: "10"}}, refund), bet.ErrBadPredicate},
+		"whitespace in station": {
+			bet.TemperatureAbove(bet.Observation{Oracle: "oracle", Station: "LFPG 0", Timestamp: 1}, "20", bet.Party{}, bet.Party{}, refund),
+			bet.ErrBadObservation,
+		},
+		"no field": {bet.Range(bet.Observation{Oracle: "oracle", Station: "LFPG"}, []bet.Bucket{{Min: "10", Max: "20"}}, refund), bet.ErrBadObservation},
+	}
+
+	for name, test := range tests {
+		if _, err := test.contract.LockingScript(); !errors.Is(err, test.err) {
+			t.Fatalf("%s: Got %v, expected %v", name, err, test.err)
+		}
+	}
+}
+
+func TestPrecipitationAbove(t *testing.T) {
+	alice, bob, carol := newWallet(t), newWallet(t), newWallet(t)
+	contract := func(obs bet.Observation) bet.Contract {
+		return bet.PrecipitationAbove(obs, "10", alice.party(), bob.party(), bet.Refund{Party: carol.party(), Timeout: timeout})
+	}
+
+	f := newFixture(t, "10.0", contract)
+	if err := f.claim(t, alice); !errors.Is(err, script.ErrVerifyFailed) {
+		t.Fatalf("Got %v, expected 10.0mm not to be more than 10mm", err)
+	}
+	if err := f.claim(t, bob); err != nil {
+		t.Fatalf("Got %v, expected bob to win at 10.0mm", err)
+	}
+
+	if winner, err := f.contract.Winner("10.2"); err != nil || winner != alice.party() {
+		t.Fatalf("Winner(10.2) == %v, %v, expected alice", winner, err)
+	}
+}
+
+func TestEscrow(t *testing.T) {
+	alice, bob, arbiter := newWallet(t), newWallet(t), newWallet(t)
+	escrow := bet.Escrow{Bettors: [2]string{alice.pubKey, bob.pubKey}, Arbiter: arbiter.pubKey}
+
+	genesis := blockchain.NewGenesisBlock([]blockchain.Transaction{
+		blockchain.NewTransaction(nil, []blockchain.TransactionOutput{{Value: 100, Script: escrow.LockingScript()}}),
+	})
+	chain := blockchain.NewChain(genesis)
+
+	settle := func(first, second wallet) error {
+		input := blockchain.TransactionInput{TXID: genesis.Transactions[0].TXID, VOUT: 0}
+		transaction := blockchain.NewTransaction([]blockchain.TransactionInput{input}, []blockchain.TransactionOutput{{Value: 100, Script: "payout"}})
+		transaction.Inputs[0].ScriptArgs = bet.EscrowArgs(first.sign(t, &chain, transaction), second.sign(t, &chain, transaction))
+		transaction.TXID = transaction.Hash()
+		return chain.CheckTransaction(transaction)
+	}
+
+	if err := settle(alice, bob); err != nil {
+		t.Fatalf("Got %v, expected both bettors to settle", err)
+	}
+	if err := settle(bob, arbiter); err != nil {
+		t.Fatalf("Got %v, expected bob and the arbiter to settle", err)
+	}
+	if err := settle(arbiter, alice); !errors.Is(err, script.ErrEvalFalse) {
+		t.Fatalf("Got %v, expected signatures out of key order to fail", err)
+	}
+}
+
+func TestPayToScriptHashContract(t *testing.T) {
+	alice, bob, carol := newWallet(t), newWallet(t), newWallet(t)
+	buckets := []bet.Bucket{{Min: "-50", Max: "0", Winner: alice.party()}}
+	for i := 0; i < 10; i++ {
+		buckets = append(buckets, bet.Bucket{Min: strconv.Itoa(i * 2), Max: strconv.Itoa(i*2 + 2), Winner: bob.party()})
+	}
+
+	f := newFixture(t, "7.5", func(obs bet.Observation) bet.Contract {
+		obs.Field = bet.FieldTemperature
+		return bet.Range(obs, buckets, bet.Refund{Party: carol.party(), Timeout: timeout})
+	})
+	f.payToScriptHash(t)
+
+	output := f.chain.GenesisBlock.Transactions[0].Outputs[0]
+	if len(output.Script) >= len(f.redeemScript) || len(f.redeemScript) <= script.MaxElementSize {
+		t.Fatalf("Output script is %d bytes for a %d bytes contract", len(output.Script), len(f.redeemScript))
+	}
+
+	if err := f.claim(t, alice); !errors.Is(err, script.ErrVerifyFailed) {
+		t.Fatalf("Got %v, expected alice's claim to fail at 7.5 degrees", err)
+	}
+	if err := f.claim(t, bob); err != nil {
+		t.Fatalf("Got %v, expected bob to win at 7.5 degrees", err)
+	}
+
+	f.redeemScript += " OPVerify"
+	if err := f.claim(t, bob); !errors.Is(err, script.ErrScriptHashMismatch) {
+		t.Fatalf("Got %v, expected a modified contract to be rejected", err)
+	}
+}
+
+func TestHTLC(t *testing.T) {
+	alice, bob := newWallet(t), newWallet(t)
+	preimage, hash, err := script.NewPreimage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, _ := script.NewPreimage()
+
+	htlc := bet.HTLC{Hash: hash, Recipient: bob.party(), Refund: bet.Refund{Party: alice.party(), Timeout: timeout}}
+	lockingScript, err := htlc.LockingScript()
+	if err != nil {
+		t.Fatal(err)
+	}
+	genesis := blockchain.NewGenesisBlock([]blockchain.Transaction{
+		blockchain.NewTransaction(nil, []blockchain.TransactionOutput{{Value: 100, Script: lockingScript}}),
+	})
+	f := betFixture{chain: blockchain.NewChain(genesis)}
+
+	claim := func(w wallet, preimage string) error {
+		return f.spend(t, w, 0, func(signature string) map[string]string {
+			return bet.HTLCClaimArgs(preimage, w.pubKey, signature)
+		})
+	}
+
+	if err := claim(bob, other); !errors.Is(err, script.ErrVerifyFailed) {
+		t.Fatalf("Got %v, expected a wrong preimage to fail", err)
+	}
+	if err := claim(alice, preimage); !errors.Is(err, script.ErrVerifyFailed) {
+		t.Fatalf("Got %v, expected only bob to claim", err)
+	}
+	if err := claim(bob, preimage); err != nil {
+		t.Fatalf("Got %v, expected bob to claim with the preimage", err)
+	}
+
+	f.mine(t, timeout)
+	if err := f.refund(t, alice, timeout-1); !errors.Is(err, script.ErrUnsatisfiedLockTime) {
+		t.Fatalf("Got %v, expected the refund to wait for the timeout", err)
+	}
+	if err := f.refund(t, alice, timeout); err != nil {
+		t.Fatalf("Got %v, expected alice to be refunded after the timeout", err)
+	}
+}
+
+func TestHTLCValidate(t *testing.T) {
+	recipient := bet.Party{PubKeyHash: "recipient"}
+	refund := bet.Refund{Party: bet.Party{PubKeyHash: "refund"}, Timeout: timeout}
+	tests := map[string]struct {
+		htlc bet.HTLC
+		err  error
+	}{
+		"no hash":      {bet.HTLC{Recipient: recipient, Refund: refund}, bet.ErrNoHash},
+		"spaced hash":  {bet.HTLC{Hash: "00 OPDrop", Recipient: recipient, Refund: refund}, bet.ErrNoHash},
+		"no recipient": {bet.HTLC{Hash: "00", Refund: refund}, bet.ErrNoRecipient},
+		"no timeout":   {bet.HTLC{Hash: "00", Recipient: recipient, Refund: bet.Refund{Party: refund.Party}}, bet.ErrNoRefund},
+		"no refund":    {bet.HTLC{Hash: "00", Recipient: recipient, Refund: bet.Refund{Timeout: timeout}}, bet.ErrNoRefund},
+	}
+
+	for name, test := range tests {
+		if _, err := test.htlc.LockingScript(); !errors.Is(err, test.err) {
+			t.Fatalf("%s: Got %v, expected %v", name, err, test.err)
+		}
+	}
+}
@@ -0,0 +1,26 @@
+package bet
+
+import "strings"
+
+// Escrow locks funds under a 2-of-3 between the two bettors and an arbiter,
+// so the bettors can settle together or either of them with the arbiter if
+// they disagree. Keys are base64 PEM public keys.
+type Escrow struct {
+	Bettors [2]string
+	Arbiter string
+}
+
+// LockingScript expects the two signatures, in the order of the keys
+// Bettors[0], Bettors[1], Arbiter, in the "sign1" and "sign2" arguments.
+func (e Escrow) LockingScript() string {
+	return strings.Join([]string{
+		"sign1 sign2 --- sign1 OPDup sign2 OPDup 2",
+		e.Bettors[0], e.Bettors[1], e.Arbiter,
+		"3 OPCheckMultiSig",
+	}, " ")
+}
+
+// EscrowArgs unlocks an Escrow with two signatures in key order.
+func EscrowArgs(first, second string) map[string]string {
+	return map[string]string{"sign1": first, "sign2": second}
+}
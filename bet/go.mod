@@ -0,0 +1,12 @@
+module bet
+
+go 1.21.4
+
+require (
+  oracle v0.0.0
+  script v0.0.0
+)
+
+replace oracle => ../oracle/
+replace script => ../script/
+replace internal/stack => ../internal/stack/
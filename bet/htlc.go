@@ -0,0 +1,57 @@
+package bet
+
+import (
+	"errors"
+	"script"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrNoHash      = errors.New("HTLC hash must be a single script token")
+	ErrNoRecipient = errors.New("HTLC has no recipient")
+)
+
+// HTLC is a hash time locked contract paying Recipient against a preimage of
+// Hash, see script.NewPreimage. Locking both legs of a bet settled on another
+// node under the same Hash lets either side claim only once the other could,
+// and Refund.Party takes the funds back if nobody claimed them by the timeout.
+type HTLC struct {
+	Hash      string
+	Recipient Party
+	Refund    Refund
+}
+
+// LockingScript has the same refund path as a Contract:
+//
+//	claim OPDup OPIf
+//	  preimage OPDup <hash lock> <pay recipient>
+//	OPElse
+//	  <timeout> OPCheckLockTimeVerify OPDrop <pay refund>
+//	OPEndIf <signature check>
+func (h HTLC) LockingScript() (string, error) {
+	if err := h.Validate(); err != nil {
+		return "", err
+	}
+
+	return strings.Join([]string{
+		"sign pubKey claim preimage --- claim OPDup OPIf preimage OPDup", script.HashLock(h.Hash), payTo(h.Recipient),
+		h.Refund.script(),
+	}, " "), nil
+}
+
+func (h HTLC) Validate() error {
+	if h.Hash == "" || strings.ContainsFunc(h.Hash, unicode.IsSpace) {
+		return ErrNoHash
+	}
+	if h.Recipient.PubKeyHash == "" {
+		return ErrNoRecipient
+	}
+	return h.Refund.validate()
+}
+
+// HTLCClaimArgs unlocks an HTLC for its recipient with the preimage. Use
+// RefundArgs for the refund path.
+func HTLCClaimArgs(preimage, pubKey, signature string) map[string]string {
+	return map[string]string{"claim": "1", "preimage": preimage, "pubKey": pubKey, "sign": signature}
+}
@@ -5,17 +5,21 @@ import (
 	"encoding/hex"
 	"fmt"
 	"internal/merkle"
-	"log"
 	"script"
 	"strings"
 	"time"
 )
 
+// TransactionInput unlocks the output VOUT of TXID with ScriptSig, pushed on
+// the stack before the output's locking script runs. ScriptArgs are the named
+// arguments older locking scripts load with OPDup. Neither is part of the
+// TXID, see Transaction.Hash.
 type TransactionInput struct {
-	TXID          string
-	VOUT          int
-	ScriptArgs    map[string]string
-	ScriptSigSize int
+	TXID       string
+	VOUT       int
+	ScriptSig  string
+	ScriptArgs map[string]string
+	Sequence   uint32
 }
 
 type TransactionOutput struct {
@@ -27,13 +31,13 @@ type Transaction struct {
 	TXID     string
 	Inputs   []TransactionInput
 	Outputs  []TransactionOutput
-	LockTime time.Duration
+	LockTime int64
 }
 
 type BlockHeader struct {
 	PrevBlockHash [32]byte
 	MerkleRoot    [32]byte
-	Time          string
+	Time          int64
 	Difficulty    int
 	Nonce         int
 	Height        int
@@ -47,43 +51,85 @@ type Block struct {
 type BlockChain struct {
 	GenesisBlock Block
 	Chain        []Block
-	UTXO         map[string][]TransactionOutput
-}
+	UTXO         UTXOSet
+	Store        Store  `json:"-"`
+	Params       Params `json:"-"`
 
-func serialize[T any](target T) string {
-	return fmt.Sprint(target)
+	nodes map[[32]byte]*blockNode
+	tip   *blockNode
+	undo  map[[32]byte]BlockUndo
 }
 
 func NewTransaction(inputs []TransactionInput, outputs []TransactionOutput) Transaction {
-	serializedInputs := serialize(inputs)
-	serializedOutputs := serialize(outputs)
-	transactionHash := sha256.Sum256([]byte(serializedInputs + serializedOutputs))
+	return NewLockedTransaction(inputs, outputs, 0)
+}
 
-	return Transaction{
-		TXID:    hex.EncodeToString(transactionHash[:]),
-		Inputs:  inputs,
-		Outputs: outputs,
+func NewLockedTransaction(inputs []TransactionInput, outputs []TransactionOutput, lockTime int64) Transaction {
+	transaction := Transaction{
+		Inputs:   inputs,
+		Outputs:  outputs,
+		LockTime: lockTime,
 	}
+	transaction.TXID = transaction.Hash()
+
+	return transaction
 }
 
-func NewBlock(prevBlock Block, transactions []Transaction) Block {
+// Hash is the TXID. It leaves out the unlocking data of the inputs, which
+// holds signatures that cannot sign themselves, so that nobody relaying the
+// transaction can give it another TXID by re-encoding them. The coinbase
+// input has no signature and keeps its height in the TXID.
+func (t *Transaction) Hash() string {
+	stripped := *t
+	if !t.IsCoinbase() {
+		stripped.Inputs = make([]TransactionInput, len(t.Inputs))
+		for i, input := range t.Inputs {
+			input.ScriptSig = ""
+			input.ScriptArgs = nil
+			stripped.Inputs[i] = input
+		}
+	}
+
+	transactionHash := sha256.Sum256(EncodeTransaction(stripped))
+	return hex.EncodeToString(transactionHash[:])
+}
+
+// WitnessHash commits to the whole transaction, unlocking data included.
+// Blocks are built over it so their hash still covers every signature.
+func (t *Transaction) WitnessHash() [32]byte {
+	return sha256.Sum256(EncodeTransaction(*t))
+}
+
+func MerkleRoot(transactions []Transaction) [32]byte {
 	var ids [][32]byte
 
+	if len(transactions) == 0 {
+		return [32]byte{}
+	}
+
 	for _, t := range transactions {
-		hexHash, err := hex.DecodeString(t.TXID)
-		if err != nil {
-			log.Fatal(err)
-		}
+		ids = append(ids, t.WitnessHash())
+	}
 
-		ids = append(ids, [32]byte(hexHash))
+	return merkle.MerkleRoot(ids)
+}
+
+func NewGenesisBlock(transactions []Transaction) Block {
+	return Block{
+		Header: BlockHeader{
+			MerkleRoot: MerkleRoot(transactions),
+		},
+		Transactions: transactions,
 	}
+}
 
+func NewBlock(prevBlock Block, transactions []Transaction) Block {
 	return Block{
 		Header: BlockHeader{
 			PrevBlockHash: prevBlock.Hash(),
-			MerkleRoot:    merkle.MerkleRoot(ids),
-			Time:          time.Now().String(),
-			Difficulty:    2,
+			MerkleRoot:    MerkleRoot(transactions),
+			Time:          time.Now().Unix(),
+			Difficulty:    DefaultParams.InitialDifficulty,
 			Nonce:         0,
 			Height:        prevBlock.Header.Height + 1,
 		},
@@ -92,60 +138,85 @@ func NewBlock(prevBlock Block, transactions []Transaction) Block {
 }
 
 func (c *BlockChain) IsUnspent(TXID string, idx int) bool {
-	val, ok := c.UTXO[TXID]
-	return ok && (idx < len(val))
+	_, ok := c.UTXO.Get(OutPoint{TXID: TXID, Index: idx})
+	return ok
 }
 
-func (c *BlockChain) Unlock(input TransactionInput) (int, bool) {
-	if !c.IsUnspent(input.TXID, input.VOUT) {
-		return 0, false
-	}
-	utxo := c.UTXO[input.TXID][input.VOUT]
+func (c *BlockChain) Unlock(t Transaction, idx int) (int, error) {
+	return c.unlock(t, idx, nil)
+}
+
+// TraceUnlock runs the script locking the output spent by input idx of t
+// and returns the stack after every instruction.
+func (c *BlockChain) TraceUnlock(t Transaction, idx int) ([]script.TraceStep, error) {
+	var steps []script.TraceStep
+	_, err := c.unlock(t, idx, func(step script.TraceStep) {
+		steps = append(steps, step)
+	})
 
-	return utxo.Value, script.EvalScript(utxo.Script, input.ScriptArgs)
+	return steps, err
 }
 
-func (c *BlockChain) Spend(input TransactionInput) bool {
-	_, ok := c.Unlock(input)
+func (c *BlockChain) unlock(t Transaction, idx int, trace func(script.TraceStep)) (int, error) {
+	input := t.Inputs[idx]
+	utxo, ok := c.UTXO.Get(input.OutPoint())
+	if !ok {
+		return 0, ErrMissingOutput
+	}
 
-	if ok {
-		if input.VOUT < len(c.UTXO[input.TXID])-1 {
-			c.UTXO[input.TXID] = append(c.UTXO[input.TXID][:input.VOUT], c.UTXO[input.TXID][input.VOUT+1:]...)
-		} else {
-			c.UTXO[input.TXID] = c.UTXO[input.TXID][:input.VOUT]
-		}
+	ctx := script.Context{
+		Args:     input.ScriptArgs,
+		LockTime: t.LockTime,
+		Sequence: input.Sequence,
+		SigHash: func(hashType byte) ([]byte, error) {
+			return SignatureHash(t, idx, utxo.Output, hashType)
+		},
+		Trace: trace,
 	}
 
-	return ok
-}
+	lockingScript, err := script.RedeemScript(utxo.Output.Script, input.ScriptArgs)
+	if err != nil {
+		return 0, err
+	}
+	if err := script.VerifyScript(input.ScriptSig, lockingScript, ctx); err != nil {
+		return 0, err
+	}
 
-func (c *BlockChain) IsValidTransaction(t Transaction) bool {
-	balance := 0
-	totalSpent := 0
+	return utxo.Output.Value, nil
+}
 
-	for _, input := range t.Inputs {
-		val, ok := c.Unlock(input)
-		if !ok {
-			return false
-		}
-		balance += val
+func (c *BlockChain) Spend(t Transaction, idx int) error {
+	if _, err := c.Unlock(t, idx); err != nil {
+		return err
 	}
 
-	for _, output := range t.Outputs {
-		totalSpent += output.Value
+	c.UTXO[t.Inputs[idx].OutPoint()].Spent = true
+	return nil
+}
+
+func (c *BlockChain) applyBlock(b Block) BlockUndo {
+	undo := c.UTXO.apply(b)
+
+	if c.undo == nil {
+		c.undo = make(map[[32]byte]BlockUndo)
 	}
+	c.undo[b.Hash()] = undo
 
-	return totalSpent <= balance
+	return undo
 }
 
-func (b *Block) Hash() [32]byte {
-	serializedBlock := serialize(b)
-	blockHash := sha256.Sum256([]byte(serializedBlock))
+func (c *BlockChain) IsValidTransaction(t Transaction) bool {
+	return c.CheckTransaction(t) == nil
+}
 
-	return blockHash
+func (b *Block) Hash() [32]byte {
+	return sha256.Sum256(EncodeBlockHeader(b.Header))
 }
 
 func (b *Block) IsValid() bool {
+	if b.Header.Difficulty < 0 {
+		return false
+	}
 	hash := b.Hash()
 	strHash := hex.EncodeToString(hash[:])
 	return strings.HasPrefix(strHash, strings.Repeat("0", b.Header.Difficulty))
@@ -171,49 +242,144 @@ func (b *Block) Mine(stopMining chan bool, callback func(Block)) {
 }
 
 func (c *BlockChain) AddBlock(b Block) bool {
-	if !b.IsValid() {
+	if _, err := c.ProcessBlock(b); err != nil {
+		fmt.Printf("Rejected block %x: %v\n", b.Hash(), err)
 		return false
 	}
 
-	transactions := b.Transactions
-	for _, transaction := range transactions {
-		if !c.IsValidTransaction(transaction) {
-			return false
-		}
+	return true
+}
+
+func (c *BlockChain) persistBlock(b Block) error {
+	if c.Store == nil {
+		return nil
+	}
+
+	if err := c.Store.Append(StoredBlock{Block: b, Undo: c.undo[b.Hash()]}, c.UTXO); err != nil {
+		return fmt.Errorf("persisting block at height %d: %w", b.Header.Height, err)
+	}
+	return nil
+}
+
+func NewChain(genesis Block) BlockChain {
+	chain := BlockChain{
+		GenesisBlock: genesis,
+		Chain:        []Block{genesis},
+		UTXO:         make(UTXOSet),
+		Params:       DefaultParams,
 	}
 
-	for _, transaction := range transactions {
-		for _, input := range transaction.Inputs {
-			c.Spend(input)
+	chain.applyBlock(genesis)
+
+	return chain
+}
+
+// LoadChain reads the chain kept in store and writes back the genesis block
+// or a rebuilt UTXO set when the store lacks them. The returned chain
+// persists every block it connects.
+func LoadChain(genesis Block, store Store) (BlockChain, error) {
+	chain, stale, err := readChain(genesis, store)
+	if err != nil {
+		return BlockChain{}, err
+	}
+
+	chain.Store = store
+	if stale {
+		if err := store.Reset(chain.storedBlocks(), chain.UTXO); err != nil {
+			return BlockChain{}, err
 		}
-		c.UTXO[transaction.TXID] = transaction.Outputs
 	}
 
-	c.Chain = append(c.Chain, b)
+	return chain, nil
+}
 
-	return true
+// ReadChain reads the chain kept in store without writing to it. A missing
+// UTXO snapshot is rebuilt in memory only.
+func ReadChain(genesis Block, store Store) (BlockChain, error) {
+	chain, _, err := readChain(genesis, store)
+	return chain, err
 }
 
-func NewChain(genesis Block) BlockChain {
+// readChain also reports whether the store is missing the genesis block or an
+// up to date UTXO snapshot.
+func readChain(genesis Block, store Store) (BlockChain, bool, error) {
+	stored, utxo, err := store.Load()
+	if err != nil {
+		return BlockChain{}, false, err
+	}
+
+	if len(stored) == 0 {
+		return NewChain(genesis), true, nil
+	}
+
+	if stored[0].Block.Hash() != genesis.Hash() {
+		return BlockChain{}, false, fmt.Errorf("stored chain has genesis %x, expected %x", stored[0].Block.Hash(), genesis.Hash())
+	}
+
 	chain := BlockChain{
 		GenesisBlock: genesis,
-		Chain:        []Block{genesis},
-		UTXO:         make(map[string][]TransactionOutput),
+		UTXO:         utxo,
+		Params:       DefaultParams,
+		undo:         make(map[[32]byte]BlockUndo),
+	}
+	for _, s := range stored {
+		chain.Chain = append(chain.Chain, s.Block)
+		chain.undo[s.Block.Hash()] = s.Undo
 	}
 
-	for _, transaction := range genesis.Transactions {
-		chain.UTXO[transaction.TXID] = transaction.Outputs
+	if utxo == nil {
+		fmt.Printf("Rebuilding UTXO set from %d stored blocks\n", len(stored))
+		chain.UTXO = make(UTXOSet)
+		for _, block := range chain.Chain {
+			chain.applyBlock(block)
+		}
+		return chain, true, nil
 	}
 
-	return chain
+	return chain, false, nil
 }
 
-func (c *BlockChain) IsValid() bool {
+// Replace switches to the blocks of other, rebuilding the UTXO set and undo
+// data from them rather than trusting the ones received. Like ProcessBlock,
+// it returns the transactions of the replaced blocks left out of other.
+func (c *BlockChain) Replace(other BlockChain) ([]Transaction, error) {
+	kept := make(map[[32]byte]bool)
+	for _, block := range other.Chain {
+		kept[block.Hash()] = true
+	}
+	var disconnected []Block
 	for _, block := range c.Chain {
-		if !block.IsValid() {
-			return false
+		if !kept[block.Hash()] {
+			disconnected = append(disconnected, block)
 		}
 	}
+	orphaned := orphanedTransactions(disconnected, other.Chain)
 
-	return true
+	c.GenesisBlock = other.GenesisBlock
+	c.Chain = other.Chain
+	c.UTXO = make(UTXOSet)
+	c.nodes = nil
+	c.tip = nil
+	c.undo = nil
+
+	for _, block := range c.Chain {
+		c.applyBlock(block)
+	}
+
+	if c.Store == nil {
+		return orphaned, nil
+	}
+	return orphaned, c.Store.Reset(c.storedBlocks(), c.UTXO)
+}
+
+func (c *BlockChain) storedBlocks() []StoredBlock {
+	var stored []StoredBlock
+	for _, block := range c.Chain {
+		stored = append(stored, StoredBlock{Block: block, Undo: c.undo[block.Hash()]})
+	}
+	return stored
+}
+
+func (c *BlockChain) IsValid() bool {
+	return c.Validate() == nil
 }
@@ -2,9 +2,24 @@ package blockchain_test
 
 import (
 	"blockchain"
+	"errors"
+	"script"
 	"testing"
 )
 
+func mine(b blockchain.Block) blockchain.Block {
+	for !b.IsValid() {
+		b.Header.Nonce += 1
+	}
+	return b
+}
+
+func mineChild(parent blockchain.Block, transactions []blockchain.Transaction) blockchain.Block {
+	b := blockchain.NewBlock(parent, transactions)
+	b.Header.Time = parent.Header.Time + 60
+	return mine(b)
+}
+
 func TestBlockAddFailure(t *testing.T) {
 	genesis := blockchain.Block{
 		Transactions: []blockchain.Transaction{
@@ -13,7 +28,7 @@ func TestBlockAddFailure(t *testing.T) {
 				[]blockchain.TransactionOutput{
 					{
 						Value:  200,
-						Script: "test --- test OPDup test1 OPEqualVerify",
+						Script: "test --- test OPDup test1 OPEqual",
 					},
 				},
 			),
@@ -23,8 +38,8 @@ func TestBlockAddFailure(t *testing.T) {
 		GenesisBlock: genesis,
 	}
 	chain.Chain = append(chain.Chain, genesis)
-	chain.UTXO = make(map[string][]blockchain.TransactionOutput)
-	chain.UTXO[genesis.Transactions[0].TXID] = genesis.Transactions[0].Outputs
+	chain.UTXO = make(blockchain.UTXOSet)
+	chain.UTXO[blockchain.OutPoint{TXID: genesis.Transactions[0].TXID, Index: 0}] = &blockchain.UTXOEntry{Output: genesis.Transactions[0].Outputs[0]}
 
 	transaction := blockchain.NewTransaction(
 		[]blockchain.TransactionInput{
@@ -37,7 +52,7 @@ func TestBlockAddFailure(t *testing.T) {
 		[]blockchain.TransactionOutput{},
 	)
 
-	ok := chain.AddBlock(blockchain.NewBlock(genesis, []blockchain.Transaction{transaction}))
+	ok := chain.AddBlock(mine(blockchain.NewBlock(genesis, []blockchain.Transaction{transaction})))
 
 	if ok {
 		t.Fatalf("Got %v, expected false", ok)
@@ -55,7 +70,7 @@ func TestBlockAddSuccess(t *testing.T) {
 				[]blockchain.TransactionOutput{
 					{
 						Value:  200,
-						Script: "test --- test OPDup test1 OPEqualVerify",
+						Script: "test --- test OPDup test1 OPEqual",
 					},
 				},
 			),
@@ -65,8 +80,8 @@ func TestBlockAddSuccess(t *testing.T) {
 		GenesisBlock: genesis,
 	}
 	chain.Chain = append(chain.Chain, genesis)
-	chain.UTXO = make(map[string][]blockchain.TransactionOutput)
-	chain.UTXO[genesis.Transactions[0].TXID] = genesis.Transactions[0].Outputs
+	chain.UTXO = make(blockchain.UTXOSet)
+	chain.UTXO[blockchain.OutPoint{TXID: genesis.Transactions[0].TXID, Index: 0}] = &blockchain.UTXOEntry{Output: genesis.Transactions[0].Outputs[0]}
 
 	transaction := blockchain.NewTransaction(
 		[]blockchain.TransactionInput{
@@ -79,7 +94,7 @@ func TestBlockAddSuccess(t *testing.T) {
 		[]blockchain.TransactionOutput{},
 	)
 
-	ok := chain.AddBlock(blockchain.NewBlock(genesis, []blockchain.Transaction{transaction}))
+	ok := chain.AddBlock(mine(blockchain.NewBlock(genesis, []blockchain.Transaction{transaction})))
 
 	if !ok {
 		t.Fatalf("Got %v, expected true", ok)
@@ -88,11 +103,53 @@ func TestBlockAddSuccess(t *testing.T) {
 		t.Fatalf("len(chain.Chain) == %v, expected 2", len(chain.Chain))
 	}
 
-	var length int
-	for _, outputs := range chain.UTXO {
-		length += len(outputs)
+	if unspent := chain.UTXO.Unspent(); len(unspent) > 0 {
+		t.Fatalf("len(chain.UTXO.Unspent()) == %v, expected 0", len(unspent))
+	}
+}
+
+func TestPayToScriptHash(t *testing.T) {
+	s := newSigner(t)
+	address := blockchain.ScriptAddress(s.lockingScript())
+	genesis := blockchain.NewGenesisBlock([]blockchain.Transaction{
+		blockchain.NewTransaction(nil, []blockchain.TransactionOutput{
+			{Value: 100, Script: script.PayToScriptHash(address)},
+		}),
+	})
+	chain := blockchain.NewChain(genesis)
+
+	if found := chain.UTXO.FindByAddress(address); len(found) != 1 {
+		t.Fatalf("len(FindByAddress()) == %v, expected 1", len(found))
+	}
+
+	spend := spendGenesis(chain, []int{0}, blockchain.TransactionOutput{Value: 90, Script: "alice"})
+	s.sign(t, &chain, &spend, 0, script.SigHashAll)
+	args := spend.Inputs[0].ScriptArgs
+
+	tests := []struct {
+		redeemScript string
+		outputScript string
+		err          error
+	}{
+		{s.lockingScript(), "alice", nil},
+		// The revealed script must hash to the address.
+		{newSigner(t).lockingScript(), "alice", script.ErrScriptHashMismatch},
+		// The redeem script runs: the signature does not cover mallory.
+		{s.lockingScript(), "mallory", script.ErrEvalFalse},
+	}
+
+	for _, test := range tests {
+		spend.Inputs[0].ScriptArgs = script.RedeemArgs(test.redeemScript, args)
+		spend.Outputs[0].Script = test.outputScript
+
+		if _, err := chain.Unlock(spend, 0); !errors.Is(err, test.err) {
+			t.Fatalf("Unlock() == %v, expected %v", err, test.err)
+		}
 	}
-	if length > 0 {
-		t.Fatalf("len(chain.UTXO) == %v, expected 0", length)
+
+	// Without the redeem script there is nothing to run.
+	spend.Inputs[0].ScriptArgs = args
+	if _, err := chain.Unlock(spend, 0); !errors.Is(err, script.ErrMissingArg) {
+		t.Fatalf("Got %v, expected ErrMissingArg", err)
 	}
 }
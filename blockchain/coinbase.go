@@ -0,0 +1,97 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+)
+
+var (
+	ErrCoinbaseOutsideBlock = errors.New("coinbase transaction is only valid as the first transaction of a block")
+	ErrMisplacedCoinbase    = errors.New("coinbase transaction is not the first transaction")
+	ErrBadCoinbaseHeight    = errors.New("coinbase height does not match block height")
+	ErrCoinbaseTooLarge     = errors.New("coinbase value exceeds subsidy plus fees")
+	ErrNegativeValue        = errors.New("output value is negative")
+	ErrValueOutOfRange      = errors.New("value exceeds the maximum amount of money")
+)
+
+// MaxMoney bounds every output value and every sum of them, so totals can
+// never overflow.
+const MaxMoney = 21000000 * 100000000
+
+var CoinbaseTXID = strings.Repeat("0", 64)
+
+const coinbaseHeightArg = "height"
+
+func NewCoinbaseTransaction(height int, value int, script string) Transaction {
+	return NewTransaction(
+		[]TransactionInput{
+			{
+				TXID:       CoinbaseTXID,
+				VOUT:       -1,
+				ScriptArgs: map[string]string{coinbaseHeightArg: strconv.Itoa(height)},
+			},
+		},
+		[]TransactionOutput{{Value: value, Script: script}},
+	)
+}
+
+func (t *Transaction) IsCoinbase() bool {
+	return len(t.Inputs) == 1 && t.Inputs[0].TXID == CoinbaseTXID && t.Inputs[0].VOUT == -1
+}
+
+func (p Params) Subsidy(height int) int {
+	if p.HalvingInterval <= 0 {
+		return p.InitialSubsidy
+	}
+
+	halvings := height / p.HalvingInterval
+	if halvings >= 63 {
+		return 0
+	}
+
+	return p.InitialSubsidy >> halvings
+}
+
+func (c *BlockChain) Subsidy(height int) int {
+	return c.params().Subsidy(height)
+}
+
+func checkCoinbase(b Block, subsidy int, fees int) error {
+	coinbase := b.Transactions[0]
+
+	if coinbase.Inputs[0].ScriptArgs[coinbaseHeightArg] != strconv.Itoa(b.Header.Height) {
+		return ErrBadCoinbaseHeight
+	}
+
+	value, err := sumOutputs(coinbase.Outputs)
+	if err != nil {
+		return err
+	}
+	if value > subsidy+fees {
+		return fmt.Errorf("%w: %d > %d", ErrCoinbaseTooLarge, value, subsidy+fees)
+	}
+
+	return nil
+}
+
+// sumOutputs adds up the output values, rejecting any value or running total
+// outside [0, MaxMoney].
+func sumOutputs(outputs []TransactionOutput) (int, error) {
+	total := 0
+	for idx, output := range outputs {
+		if output.Value < 0 {
+			return 0, fmt.Errorf("output %d: %w: %d", idx, ErrNegativeValue, output.Value)
+		}
+		if output.Value > MaxMoney {
+			return 0, fmt.Errorf("output %d: %w: %d", idx, ErrValueOutOfRange, output.Value)
+		}
+
+		total += output.Value
+		if total > MaxMoney {
+			return 0, fmt.Errorf("outputs: %w: total after output %d", ErrValueOutOfRange, idx)
+		}
+	}
+	return total, nil
+}
@@ -0,0 +1,124 @@
+package blockchain_test
+
+import (
+	"blockchain"
+	"errors"
+	"math"
+	"testing"
+)
+
+const minerScript = "test --- test OPDup miner OPEqual"
+
+func TestCoinbaseRewardsMiner(t *testing.T) {
+	genesis := storeGenesis()
+	chain := blockchain.NewChain(genesis)
+
+	coinbase := blockchain.NewCoinbaseTransaction(1, chain.Subsidy(1), minerScript)
+	if _, err := chain.ProcessBlock(mineChild(genesis, []blockchain.Transaction{coinbase})); err != nil {
+		t.Fatalf("Got %v, expected nil", err)
+	}
+	if !chain.IsUnspent(coinbase.TXID, 0) {
+		t.Fatalf("Coinbase output missing from UTXO set")
+	}
+}
+
+func TestCoinbaseClaimsFees(t *testing.T) {
+	genesis := storeGenesis()
+	chain := blockchain.NewChain(genesis)
+
+	// storeSpend leaves 50 of the 200 genesis output as fee.
+	spend := storeSpend(genesis)
+	coinbase := blockchain.NewCoinbaseTransaction(1, chain.Subsidy(1)+50, minerScript)
+	if _, err := chain.ProcessBlock(mineChild(genesis, []blockchain.Transaction{coinbase, spend})); err != nil {
+		t.Fatalf("Got %v, expected nil", err)
+	}
+}
+
+func TestCoinbaseTooLarge(t *testing.T) {
+	genesis := storeGenesis()
+	chain := blockchain.NewChain(genesis)
+
+	coinbase := blockchain.NewCoinbaseTransaction(1, chain.Subsidy(1)+1, minerScript)
+	_, err := chain.ProcessBlock(mineChild(genesis, []blockchain.Transaction{coinbase}))
+	if !errors.Is(err, blockchain.ErrCoinbaseTooLarge) {
+		t.Fatalf("Got %v, expected ErrCoinbaseTooLarge", err)
+	}
+}
+
+func TestCoinbaseNegativeOutput(t *testing.T) {
+	genesis := storeGenesis()
+	chain := blockchain.NewChain(genesis)
+
+	// The outputs sum to the subsidy, but mint 1000000 + subsidy to the miner.
+	coinbase := blockchain.NewCoinbaseTransaction(1, -1000000, minerScript)
+	coinbase.Outputs = append(coinbase.Outputs, blockchain.TransactionOutput{Value: 1000000 + chain.Subsidy(1), Script: minerScript})
+	coinbase.TXID = coinbase.Hash()
+	_, err := chain.ProcessBlock(mineChild(genesis, []blockchain.Transaction{coinbase}))
+	if !errors.Is(err, blockchain.ErrNegativeValue) {
+		t.Fatalf("Got %v, expected ErrNegativeValue", err)
+	}
+}
+
+func TestCoinbaseOutputsOverflow(t *testing.T) {
+	genesis := storeGenesis()
+	chain := blockchain.NewChain(genesis)
+
+	// Added up as ints, the outputs wrap around to less than the subsidy.
+	coinbase := blockchain.NewCoinbaseTransaction(1, math.MaxInt64, minerScript)
+	coinbase.Outputs = append(coinbase.Outputs, blockchain.TransactionOutput{Value: 2, Script: minerScript})
+	coinbase.TXID = coinbase.Hash()
+	_, err := chain.ProcessBlock(mineChild(genesis, []blockchain.Transaction{coinbase}))
+	if !errors.Is(err, blockchain.ErrValueOutOfRange) {
+		t.Fatalf("Got %v, expected ErrValueOutOfRange", err)
+	}
+
+	// Each output is in range but their sum is not.
+	coinbase = blockchain.NewCoinbaseTransaction(1, blockchain.MaxMoney, minerScript)
+	coinbase.Outputs = append(coinbase.Outputs, blockchain.TransactionOutput{Value: 1, Script: minerScript})
+	coinbase.TXID = coinbase.Hash()
+	_, err = chain.ProcessBlock(mineChild(genesis, []blockchain.Transaction{coinbase}))
+	if !errors.Is(err, blockchain.ErrValueOutOfRange) {
+		t.Fatalf("Got %v, expected ErrValueOutOfRange", err)
+	}
+}
+
+func TestSecondCoinbaseRejected(t *testing.T) {
+	genesis := storeGenesis()
+	chain := blockchain.NewChain(genesis)
+
+	first := blockchain.NewCoinbaseTransaction(1, 1, minerScript)
+	second := blockchain.NewCoinbaseTransaction(1, 2, minerScript)
+	_, err := chain.ProcessBlock(mineChild(genesis, []blockchain.Transaction{first, second}))
+	if !errors.Is(err, blockchain.ErrMisplacedCoinbase) {
+		t.Fatalf("Got %v, expected ErrMisplacedCoinbase", err)
+	}
+}
+
+func TestCoinbaseHeightMismatch(t *testing.T) {
+	genesis := storeGenesis()
+	chain := blockchain.NewChain(genesis)
+
+	coinbase := blockchain.NewCoinbaseTransaction(5, 1, minerScript)
+	_, err := chain.ProcessBlock(mineChild(genesis, []blockchain.Transaction{coinbase}))
+	if !errors.Is(err, blockchain.ErrBadCoinbaseHeight) {
+		t.Fatalf("Got %v, expected ErrBadCoinbaseHeight", err)
+	}
+}
+
+func TestCoinbaseNotValidAlone(t *testing.T) {
+	chain := blockchain.NewChain(storeGenesis())
+
+	if chain.IsValidTransaction(blockchain.NewCoinbaseTransaction(1, 1, minerScript)) {
+		t.Fatalf("Got true, expected coinbase to be rejected outside a block")
+	}
+}
+
+func TestSubsidyHalving(t *testing.T) {
+	params := blockchain.Params{InitialSubsidy: 50, HalvingInterval: 100}
+
+	for _, tc := range []struct{ height, subsidy int }{{0, 50}, {99, 50}, {100, 25}, {250, 12}, {700, 0}} {
+		if subsidy := params.Subsidy(tc.height); subsidy != tc.subsidy {
+			t.Fatalf("Subsidy(%d) == %v, expected %v", tc.height, subsidy, tc.subsidy)
+		}
+	}
+}
@@ -0,0 +1,89 @@
+package blockchain
+
+import (
+	"errors"
+	"sort"
+	"time"
+)
+
+var (
+	ErrBadDifficulty = errors.New("difficulty does not match required difficulty")
+	ErrBadTimestamp  = errors.New("timestamp is not after median time of previous blocks")
+	ErrFutureBlock   = errors.New("timestamp is too far in the future")
+)
+
+const medianTimeSpan = 11
+
+// requiredDifficulty returns the difficulty a child of parent must carry.
+// Every RetargetInterval blocks the time taken by the previous window is
+// compared to the target, and since each difficulty step is a further
+// leading zero hex digit (16 times the work) it only moves by one step when
+// blocks came more than twice as fast or slow as intended.
+func (c *BlockChain) requiredDifficulty(parent *blockNode) int {
+	params := c.params()
+	height := parent.block.Header.Height + 1
+
+	if parent.parent == nil {
+		return params.InitialDifficulty
+	}
+	if height%params.RetargetInterval != 0 {
+		return parent.block.Header.Difficulty
+	}
+
+	intervals := params.RetargetInterval - 1
+	first := parent
+	for i := 0; i < intervals && first.parent != nil; i++ {
+		first = first.parent
+	}
+	if first.parent == nil {
+		return parent.block.Header.Difficulty
+	}
+
+	actual := time.Duration(parent.block.Header.Time-first.block.Header.Time) * time.Second
+	expected := time.Duration(intervals) * params.TargetBlockInterval
+	difficulty := parent.block.Header.Difficulty
+
+	if actual < expected/2 {
+		difficulty++
+	} else if actual > expected*2 {
+		difficulty--
+	}
+	if difficulty < params.MinDifficulty {
+		difficulty = params.MinDifficulty
+	}
+
+	return difficulty
+}
+
+func medianTimePast(node *blockNode) int64 {
+	var times []int64
+
+	for i := 0; i < medianTimeSpan && node != nil; i++ {
+		times = append(times, node.block.Header.Time)
+		node = node.parent
+	}
+	sort.Slice(times, func(i, j int) bool { return times[i] < times[j] })
+
+	return times[len(times)/2]
+}
+
+func (c *BlockChain) NextDifficulty() int {
+	c.ensureIndex()
+	return c.requiredDifficulty(c.tip)
+}
+
+func (c *BlockChain) TargetBlockInterval() time.Duration {
+	return c.params().TargetBlockInterval
+}
+
+// NewCandidateBlock builds the next block at the current time, or just after
+// the median time past if the clock lags behind the chain.
+func (c *BlockChain) NewCandidateBlock(transactions []Transaction) Block {
+	candidate := NewBlock(c.Chain[len(c.Chain)-1], transactions)
+	candidate.Header.Difficulty = c.NextDifficulty()
+	if minTime := medianTimePast(c.tip) + 1; candidate.Header.Time < minTime {
+		candidate.Header.Time = minTime
+	}
+
+	return candidate
+}
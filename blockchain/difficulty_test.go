@@ -0,0 +1,97 @@
+package blockchain_test
+
+import (
+	"blockchain"
+	"errors"
+	"testing"
+	"time"
+)
+
+func retargetChain(t *testing.T, blocks int, spacing int64) blockchain.BlockChain {
+	chain := blockchain.NewChain(storeGenesis())
+	chain.Params = blockchain.Params{
+		TargetBlockInterval: time.Minute,
+		RetargetInterval:    4,
+		InitialDifficulty:   1,
+		MinDifficulty:       1,
+		MaxFutureBlockTime:  2 * time.Hour,
+	}
+
+	for i := 0; i < blocks; i++ {
+		candidate := chain.NewCandidateBlock([]blockchain.Transaction{})
+		candidate.Header.Time = chain.Chain[len(chain.Chain)-1].Header.Time + spacing
+		if _, err := chain.ProcessBlock(mine(candidate)); err != nil {
+			t.Fatalf("Block %d rejected: %v", i+1, err)
+		}
+	}
+
+	return chain
+}
+
+func TestDifficultyIncreasesWhenBlocksAreFast(t *testing.T) {
+	chain := retargetChain(t, 7, 1)
+
+	if difficulty := chain.NextDifficulty(); difficulty != 2 {
+		t.Fatalf("NextDifficulty() == %v, expected 2", difficulty)
+	}
+}
+
+func TestDifficultyStableOnTarget(t *testing.T) {
+	chain := retargetChain(t, 7, 60)
+
+	if difficulty := chain.NextDifficulty(); difficulty != 1 {
+		t.Fatalf("NextDifficulty() == %v, expected 1", difficulty)
+	}
+}
+
+func TestDifficultyNeverBelowMinimum(t *testing.T) {
+	chain := retargetChain(t, 7, 3600)
+
+	if difficulty := chain.NextDifficulty(); difficulty != 1 {
+		t.Fatalf("NextDifficulty() == %v, expected 1", difficulty)
+	}
+}
+
+func TestRejectsWrongDifficulty(t *testing.T) {
+	genesis := storeGenesis()
+	chain := blockchain.NewChain(genesis)
+
+	easy := blockchain.NewBlock(genesis, []blockchain.Transaction{})
+	easy.Header.Time = 60
+	easy.Header.Difficulty = 0
+
+	if _, err := chain.ProcessBlock(easy); !errors.Is(err, blockchain.ErrBadDifficulty) {
+		t.Fatalf("Got %v, expected ErrBadDifficulty", err)
+	}
+}
+
+func TestRejectsStaleTimestamp(t *testing.T) {
+	genesis := storeGenesis()
+	chain := blockchain.NewChain(genesis)
+
+	stale := blockchain.NewBlock(genesis, []blockchain.Transaction{})
+	stale.Header.Time = genesis.Header.Time
+
+	if _, err := chain.ProcessBlock(mine(stale)); !errors.Is(err, blockchain.ErrBadTimestamp) {
+		t.Fatalf("Got %v, expected ErrBadTimestamp", err)
+	}
+}
+
+func TestCandidateBlockAfterMedianTimePast(t *testing.T) {
+	chain := retargetChain(t, 0, 0)
+
+	// Blocks from a peer whose clock runs an hour ahead.
+	ahead := time.Now().Add(time.Hour).Unix()
+	for i := int64(0); i < 3; i++ {
+		block := blockchain.NewBlock(chain.Chain[len(chain.Chain)-1], []blockchain.Transaction{})
+		block.Header.Time = ahead + i
+		block.Header.Difficulty = chain.NextDifficulty()
+		if _, err := chain.ProcessBlock(mine(block)); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := chain.ProcessBlock(mine(chain.NewCandidateBlock([]blockchain.Transaction{}))); err != nil {
+		t.Fatalf("Got %v, expected the candidate block to be accepted", err)
+	}
+}
@@ -0,0 +1,312 @@
+package blockchain
+
+import (
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"sort"
+)
+
+// EncodingVersion prefixes every encoded Transaction and BlockHeader. All
+// integers are big-endian, counts and string lengths are uint32 prefixes and
+// ScriptArgs are written sorted by key. Version 2 replaced the unused
+// ScriptSigSize of inputs with their ScriptSig.
+const EncodingVersion byte = 2
+
+var ErrUnsupportedVersion = errors.New("unsupported encoding version")
+
+func EncodeTransaction(t Transaction) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteByte(EncodingVersion)
+	writeUint32(&buf, uint32(len(t.Inputs)))
+	for _, input := range t.Inputs {
+		buf.Write(EncodeTransactionInput(input))
+	}
+	writeUint32(&buf, uint32(len(t.Outputs)))
+	for _, output := range t.Outputs {
+		buf.Write(EncodeTransactionOutput(output))
+	}
+	writeInt64(&buf, t.LockTime)
+
+	return buf.Bytes()
+}
+
+func DecodeTransaction(data []byte) (Transaction, error) {
+	r := bytes.NewReader(data)
+	t, err := readTransaction(r)
+	if err != nil {
+		return Transaction{}, err
+	}
+	if r.Len() != 0 {
+		return Transaction{}, fmt.Errorf("%d trailing bytes after transaction", r.Len())
+	}
+
+	return t, nil
+}
+
+func EncodeTransactionInput(input TransactionInput) []byte {
+	var buf bytes.Buffer
+
+	writeString(&buf, input.TXID)
+	writeInt64(&buf, int64(input.VOUT))
+
+	keys := make([]string, 0, len(input.ScriptArgs))
+	for key := range input.ScriptArgs {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	writeUint32(&buf, uint32(len(keys)))
+	for _, key := range keys {
+		writeString(&buf, key)
+		writeString(&buf, input.ScriptArgs[key])
+	}
+	writeString(&buf, input.ScriptSig)
+	writeUint32(&buf, input.Sequence)
+
+	return buf.Bytes()
+}
+
+func DecodeTransactionInput(data []byte) (TransactionInput, error) {
+	r := bytes.NewReader(data)
+	input, err := readTransactionInput(r)
+	if err != nil {
+		return TransactionInput{}, err
+	}
+	if r.Len() != 0 {
+		return TransactionInput{}, fmt.Errorf("%d trailing bytes after input", r.Len())
+	}
+
+	return input, nil
+}
+
+func EncodeTransactionOutput(output TransactionOutput) []byte {
+	var buf bytes.Buffer
+
+	writeInt64(&buf, int64(output.Value))
+	writeString(&buf, output.Script)
+
+	return buf.Bytes()
+}
+
+func DecodeTransactionOutput(data []byte) (TransactionOutput, error) {
+	r := bytes.NewReader(data)
+	output, err := readTransactionOutput(r)
+	if err != nil {
+		return TransactionOutput{}, err
+	}
+	if r.Len() != 0 {
+		return TransactionOutput{}, fmt.Errorf("%d trailing bytes after output", r.Len())
+	}
+
+	return output, nil
+}
+
+func EncodeBlockHeader(h BlockHeader) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteByte(EncodingVersion)
+	buf.Write(h.PrevBlockHash[:])
+	buf.Write(h.MerkleRoot[:])
+	writeInt64(&buf, h.Time)
+	writeInt64(&buf, int64(h.Difficulty))
+	writeInt64(&buf, int64(h.Nonce))
+	writeInt64(&buf, int64(h.Height))
+
+	return buf.Bytes()
+}
+
+func DecodeBlockHeader(data []byte) (BlockHeader, error) {
+	var h BlockHeader
+	r := bytes.NewReader(data)
+
+	version, err := r.ReadByte()
+	if err != nil {
+		return h, err
+	}
+	if version != EncodingVersion {
+		return h, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+
+	if _, err := io.ReadFull(r, h.PrevBlockHash[:]); err != nil {
+		return h, err
+	}
+	if _, err := io.ReadFull(r, h.MerkleRoot[:]); err != nil {
+		return h, err
+	}
+
+	if h.Time, err = readInt64(r); err != nil {
+		return h, err
+	}
+	difficulty, err := readInt64(r)
+	if err != nil {
+		return h, err
+	}
+	nonce, err := readInt64(r)
+	if err != nil {
+		return h, err
+	}
+	height, err := readInt64(r)
+	if err != nil {
+		return h, err
+	}
+	h.Difficulty = int(difficulty)
+	h.Nonce = int(nonce)
+	h.Height = int(height)
+
+	if r.Len() != 0 {
+		return h, fmt.Errorf("%d trailing bytes after block header", r.Len())
+	}
+
+	return h, nil
+}
+
+func readTransaction(r *bytes.Reader) (Transaction, error) {
+	var t Transaction
+
+	version, err := r.ReadByte()
+	if err != nil {
+		return t, err
+	}
+	if version != EncodingVersion {
+		return t, fmt.Errorf("%w: %d", ErrUnsupportedVersion, version)
+	}
+
+	inputCount, err := readCount(r)
+	if err != nil {
+		return t, err
+	}
+	for i := 0; i < inputCount; i++ {
+		input, err := readTransactionInput(r)
+		if err != nil {
+			return t, fmt.Errorf("input %d: %w", i, err)
+		}
+		t.Inputs = append(t.Inputs, input)
+	}
+
+	outputCount, err := readCount(r)
+	if err != nil {
+		return t, err
+	}
+	for i := 0; i < outputCount; i++ {
+		output, err := readTransactionOutput(r)
+		if err != nil {
+			return t, fmt.Errorf("output %d: %w", i, err)
+		}
+		t.Outputs = append(t.Outputs, output)
+	}
+
+	if t.LockTime, err = readInt64(r); err != nil {
+		return t, err
+	}
+	t.TXID = t.Hash()
+
+	return t, nil
+}
+
+func readTransactionInput(r *bytes.Reader) (TransactionInput, error) {
+	var input TransactionInput
+	var err error
+
+	if input.TXID, err = readString(r); err != nil {
+		return input, err
+	}
+	vout, err := readInt64(r)
+	if err != nil {
+		return input, err
+	}
+	input.VOUT = int(vout)
+
+	argCount, err := readCount(r)
+	if err != nil {
+		return input, err
+	}
+	if argCount > 0 {
+		input.ScriptArgs = make(map[string]string, argCount)
+	}
+	for i := 0; i < argCount; i++ {
+		key, err := readString(r)
+		if err != nil {
+			return input, err
+		}
+		value, err := readString(r)
+		if err != nil {
+			return input, err
+		}
+		input.ScriptArgs[key] = value
+	}
+
+	if input.ScriptSig, err = readString(r); err != nil {
+		return input, err
+	}
+
+	if err := binary.Read(r, binary.BigEndian, &input.Sequence); err != nil {
+		return input, err
+	}
+
+	return input, nil
+}
+
+func readTransactionOutput(r *bytes.Reader) (TransactionOutput, error) {
+	var output TransactionOutput
+
+	value, err := readInt64(r)
+	if err != nil {
+		return output, err
+	}
+	output.Value = int(value)
+
+	if output.Script, err = readString(r); err != nil {
+		return output, err
+	}
+
+	return output, nil
+}
+
+func writeUint32(buf *bytes.Buffer, v uint32) {
+	binary.Write(buf, binary.BigEndian, v)
+}
+
+func writeInt64(buf *bytes.Buffer, v int64) {
+	binary.Write(buf, binary.BigEndian, v)
+}
+
+func writeString(buf *bytes.Buffer, s string) {
+	writeUint32(buf, uint32(len(s)))
+	buf.WriteString(s)
+}
+
+func readCount(r *bytes.Reader) (int, error) {
+	var n uint32
+	if err := binary.Read(r, binary.BigEndian, &n); err != nil {
+		return 0, err
+	}
+	if int64(n) > int64(r.Len()) {
+		return 0, fmt.Errorf("count %d exceeds remaining %d bytes", n, r.Len())
+	}
+
+	return int(n), nil
+}
+
+func readInt64(r *bytes.Reader) (int64, error) {
+	var v int64
+	err := binary.Read(r, binary.BigEndian, &v)
+	return v, err
+}
+
+func readString(r *bytes.Reader) (string, error) {
+	n, err := readCount(r)
+	if err != nil {
+		return "", err
+	}
+
+	b := make([]byte, n)
+	if _, err := io.ReadFull(r, b); err != nil {
+		return "", err
+	}
+
+	return string(b), nil
+}
@@ -0,0 +1,113 @@
+package blockchain_test
+
+import (
+	"blockchain"
+	"bytes"
+	"encoding/hex"
+	"errors"
+	"reflect"
+	"testing"
+)
+
+func encodingTransaction() blockchain.Transaction {
+	return blockchain.NewTransaction(
+		[]blockchain.TransactionInput{
+			{
+				TXID:       "c8616cbb9ff627527f67226afffda3e523a5a6f2cb2b6d69b5ea4d91af23de53",
+				VOUT:       1,
+				ScriptSig:  "c2ln cHVi",
+				ScriptArgs: map[string]string{"sign": "c2ln", "pubKey": "cHVi", "a": ""},
+			},
+		},
+		[]blockchain.TransactionOutput{
+			{Value: 30, Script: "test --- test OPDup test1 OPEqualVerify"},
+			{Value: 170, Script: ""},
+		},
+	)
+}
+
+func TestTransactionEncodingRoundTrip(t *testing.T) {
+	transaction := encodingTransaction()
+
+	decoded, err := blockchain.DecodeTransaction(blockchain.EncodeTransaction(transaction))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reflect.DeepEqual(decoded, transaction) {
+		t.Fatalf("Got %v, expected %v", decoded, transaction)
+	}
+}
+
+func TestTXIDLeavesOutUnlockingData(t *testing.T) {
+	transaction := encodingTransaction()
+	witnessHash := transaction.WitnessHash()
+
+	transaction.Inputs[0].ScriptSig = "c2lnMg== cHVi"
+	transaction.Inputs[0].ScriptArgs = nil
+	if transaction.Hash() != transaction.TXID {
+		t.Fatalf("TXID changed with the unlocking data")
+	}
+	if transaction.WitnessHash() == witnessHash {
+		t.Fatalf("Witness hash did not change with the unlocking data")
+	}
+
+	// Coinbases have no signature, their height keeps their TXIDs unique.
+	if blockchain.NewCoinbaseTransaction(1, 50, "miner").TXID == blockchain.NewCoinbaseTransaction(2, 50, "miner").TXID {
+		t.Fatalf("Coinbases at different heights share a TXID")
+	}
+}
+
+func TestTransactionEncodingDeterministic(t *testing.T) {
+	expected := blockchain.EncodeTransaction(encodingTransaction())
+
+	for i := 0; i < 20; i++ {
+		if encoded := blockchain.EncodeTransaction(encodingTransaction()); !bytes.Equal(encoded, expected) {
+			t.Fatalf("Encoding changed between runs: %x != %x", encoded, expected)
+		}
+	}
+
+	output := blockchain.EncodeTransactionOutput(blockchain.TransactionOutput{Value: 30, Script: "ab"})
+	if hex.EncodeToString(output) != "000000000000001e000000026162" {
+		t.Fatalf("Got %x, expected 000000000000001e000000026162", output)
+	}
+}
+
+func TestBlockHeaderEncodingRoundTrip(t *testing.T) {
+	header := blockchain.BlockHeader{
+		PrevBlockHash: [32]byte{1, 2, 3},
+		MerkleRoot:    [32]byte{4, 5, 6},
+		Time:          1700000000,
+		Difficulty:    2,
+		Nonce:         42,
+		Height:        7,
+	}
+
+	encoded := blockchain.EncodeBlockHeader(header)
+	if len(encoded) != 1+32+32+4*8 {
+		t.Fatalf("len(encoded) == %v, expected %v", len(encoded), 1+32+32+4*8)
+	}
+
+	decoded, err := blockchain.DecodeBlockHeader(encoded)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if decoded != header {
+		t.Fatalf("Got %v, expected %v", decoded, header)
+	}
+}
+
+func TestDecodeRejectsBadInput(t *testing.T) {
+	encoded := blockchain.EncodeTransaction(encodingTransaction())
+
+	if _, err := blockchain.DecodeTransaction(encoded[:len(encoded)-3]); err == nil {
+		t.Fatalf("Got nil error decoding truncated transaction")
+	}
+	if _, err := blockchain.DecodeTransaction(append(encoded, 0)); err == nil {
+		t.Fatalf("Got nil error decoding transaction with trailing bytes")
+	}
+
+	encoded[0] = 99
+	if _, err := blockchain.DecodeTransaction(encoded); !errors.Is(err, blockchain.ErrUnsupportedVersion) {
+		t.Fatalf("Got %v, expected ErrUnsupportedVersion", err)
+	}
+}
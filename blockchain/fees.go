@@ -0,0 +1,82 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"sort"
+)
+
+var ErrBlockTooLarge = errors.New("block transactions exceed maximum block size")
+
+func TransactionSize(t Transaction) int {
+	return len(EncodeTransaction(t))
+}
+
+func BlockSize(transactions []Transaction) int {
+	size := 0
+	for _, transaction := range transactions {
+		size += TransactionSize(transaction)
+	}
+	return size
+}
+
+// FeeRate returns the fee paid by t per byte of its canonical encoding.
+func (c *BlockChain) FeeRate(t Transaction) (float64, error) {
+	fee, err := c.TransactionFee(t)
+	if err != nil {
+		return 0, err
+	}
+
+	return float64(fee) / float64(TransactionSize(t)), nil
+}
+
+func checkBlockSize(b Block, maxSize int) error {
+	if size := BlockSize(b.Transactions); size > maxSize {
+		return fmt.Errorf("%w: %d > %d", ErrBlockTooLarge, size, maxSize)
+	}
+	return nil
+}
+
+// SelectTransactions picks the transactions of pool with the highest fee rate
+// that fit in a block alongside reserved bytes (usually the coinbase). It
+// returns the selection, the total fee it pays and the valid transactions
+// left over; invalid transactions are dropped.
+func (c *BlockChain) SelectTransactions(pool []Transaction, reserved int) ([]Transaction, int, []Transaction) {
+	type candidate struct {
+		transaction Transaction
+		fee         int
+		size        int
+	}
+
+	var candidates []candidate
+	for _, transaction := range pool {
+		fee, err := c.TransactionFee(transaction)
+		if err != nil {
+			fmt.Printf("Dropping transaction %s from pool: %v\n", transaction.TXID, err)
+			continue
+		}
+		candidates = append(candidates, candidate{transaction, fee, TransactionSize(transaction)})
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		return candidates[i].fee*candidates[j].size > candidates[j].fee*candidates[i].size
+	})
+
+	var selected []Transaction
+	var remaining []Transaction
+	fees := 0
+	space := c.params().MaxBlockSize - reserved
+
+	for _, candidate := range candidates {
+		if candidate.size > space {
+			remaining = append(remaining, candidate.transaction)
+			continue
+		}
+
+		selected = append(selected, candidate.transaction)
+		fees += candidate.fee
+		space -= candidate.size
+	}
+
+	return selected, fees, remaining
+}
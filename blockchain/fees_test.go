@@ -0,0 +1,105 @@
+package blockchain_test
+
+import (
+	"blockchain"
+	"errors"
+	"math"
+	"testing"
+)
+
+func feeChain() (blockchain.BlockChain, []blockchain.Transaction) {
+	script := "test --- test OPDup test1 OPEqual"
+	genesis := blockchain.NewGenesisBlock([]blockchain.Transaction{
+		blockchain.NewTransaction(
+			[]blockchain.TransactionInput{},
+			[]blockchain.TransactionOutput{{Value: 100, Script: script}, {Value: 100, Script: script}, {Value: 100, Script: script}},
+		),
+	})
+	chain := blockchain.NewChain(genesis)
+
+	var spends []blockchain.Transaction
+	for vout, fee := range []int{10, 30, 20} {
+		spends = append(spends, blockchain.NewTransaction(
+			[]blockchain.TransactionInput{
+				{TXID: genesis.Transactions[0].TXID, VOUT: vout, ScriptArgs: map[string]string{"test": "test1"}},
+			},
+			[]blockchain.TransactionOutput{{Value: 100 - fee, Script: script}},
+		))
+	}
+
+	return chain, spends
+}
+
+func TestTransactionFee(t *testing.T) {
+	chain, spends := feeChain()
+
+	fee, err := chain.TransactionFee(spends[1])
+	if err != nil || fee != 30 {
+		t.Fatalf("TransactionFee() == %v, %v, expected 30, nil", fee, err)
+	}
+
+	rate, err := chain.FeeRate(spends[1])
+	if err != nil || rate != 30/float64(blockchain.TransactionSize(spends[1])) {
+		t.Fatalf("FeeRate() == %v, %v, expected %v", rate, err, 30/float64(blockchain.TransactionSize(spends[1])))
+	}
+}
+
+func TestNegativeOutputValue(t *testing.T) {
+	chain, spends := feeChain()
+
+	// The outputs sum to 99 of the 100 spent, but create 1000099 out of nothing.
+	spend := spends[0]
+	spend.Outputs = []blockchain.TransactionOutput{{Value: -1000000, Script: "mallory"}, {Value: 100 + 1000000 - 1, Script: "mallory"}}
+	spend.TXID = spend.Hash()
+
+	_, err := chain.TransactionFee(spend)
+	if !errors.Is(err, blockchain.ErrNegativeValue) {
+		t.Fatalf("Got %v, expected ErrNegativeValue", err)
+	}
+}
+
+func TestOutputsOverflow(t *testing.T) {
+	chain, spends := feeChain()
+
+	// Added up as ints, the outputs wrap around to less than the 100 spent.
+	spend := spends[0]
+	spend.Outputs = []blockchain.TransactionOutput{{Value: math.MaxInt64, Script: "mallory"}, {Value: 2, Script: "mallory"}}
+	spend.TXID = spend.Hash()
+
+	if _, err := chain.TransactionFee(spend); !errors.Is(err, blockchain.ErrValueOutOfRange) {
+		t.Fatalf("Got %v, expected ErrValueOutOfRange", err)
+	}
+	if _, err := chain.ProcessBlock(mineChild(chain.GenesisBlock, []blockchain.Transaction{spend})); !errors.Is(err, blockchain.ErrValueOutOfRange) {
+		t.Fatalf("Got %v, expected ErrValueOutOfRange", err)
+	}
+}
+
+func TestSelectTransactionsByFeeRate(t *testing.T) {
+	chain, spends := feeChain()
+	size := blockchain.TransactionSize(spends[0])
+	chain.Params = blockchain.DefaultParams
+	chain.Params.MaxBlockSize = 2 * size
+
+	selected, fees, remaining := chain.SelectTransactions(spends, 0)
+
+	if len(selected) != 2 || selected[0].TXID != spends[1].TXID || selected[1].TXID != spends[2].TXID {
+		t.Fatalf("Got %v, expected the two highest fee transactions", selected)
+	}
+	if fees != 50 {
+		t.Fatalf("fees == %v, expected 50", fees)
+	}
+	if len(remaining) != 1 || remaining[0].TXID != spends[0].TXID {
+		t.Fatalf("Got remaining %v, expected the lowest fee transaction", remaining)
+	}
+}
+
+func TestBlockTooLarge(t *testing.T) {
+	chain, spends := feeChain()
+	chain.Params = blockchain.DefaultParams
+	chain.Params.MaxBlockSize = blockchain.TransactionSize(spends[0])
+
+	_, err := chain.ProcessBlock(mineChild(chain.GenesisBlock, spends[:2]))
+	if !errors.Is(err, blockchain.ErrBlockTooLarge) {
+		t.Fatalf("Got %v, expected ErrBlockTooLarge", err)
+	}
+}
@@ -0,0 +1,78 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"script"
+)
+
+var (
+	ErrLockTimeNotReached     = errors.New("transaction lock time not reached")
+	ErrSequenceLockNotReached = errors.New("relative lock time not reached")
+)
+
+// lockContext is the height and median time past a transaction is checked
+// against, i.e. those of the block it would be included in.
+type lockContext struct {
+	height int
+	time   int64
+}
+
+func (c *BlockChain) nextLockContext() lockContext {
+	c.ensureIndex()
+	return lockContext{height: c.tip.block.Header.Height + 1, time: medianTimePast(c.tip)}
+}
+
+func checkLockTime(t Transaction, ctx lockContext) error {
+	if t.LockTime == 0 {
+		return nil
+	}
+
+	limit := int64(ctx.height)
+	if t.LockTime >= script.LockTimeThreshold {
+		limit = ctx.time
+	}
+
+	if t.LockTime >= limit {
+		return fmt.Errorf("%w: %d >= %d", ErrLockTimeNotReached, t.LockTime, limit)
+	}
+
+	return nil
+}
+
+func (c *BlockChain) checkSequenceLock(input TransactionInput, ctx lockContext) error {
+	sequence := input.Sequence
+	if sequence&script.SequenceLockTimeDisableFlag != 0 {
+		return nil
+	}
+
+	entry, ok := c.UTXO.Get(input.OutPoint())
+	if !ok {
+		return nil
+	}
+	value := int64(sequence & script.SequenceLockTimeMask)
+
+	if sequence&script.SequenceLockTimeTypeFlag != 0 {
+		required := value << script.SequenceLockTimeGranularity
+		elapsed := ctx.time - c.medianTimePastAt(entry.Height-1)
+		if elapsed < required {
+			return fmt.Errorf("%w: %ds of %ds elapsed", ErrSequenceLockNotReached, elapsed, required)
+		}
+		return nil
+	}
+
+	if confirmations := int64(ctx.height - entry.Height); confirmations < value {
+		return fmt.Errorf("%w: %d of %d blocks", ErrSequenceLockNotReached, confirmations, value)
+	}
+
+	return nil
+}
+
+func (c *BlockChain) medianTimePastAt(height int) int64 {
+	c.ensureIndex()
+	if height < 0 {
+		height = 0
+	}
+
+	return medianTimePast(c.nodes[c.Chain[height].Hash()])
+}
@@ -0,0 +1,64 @@
+package blockchain_test
+
+import (
+	"blockchain"
+	"errors"
+	"script"
+	"testing"
+)
+
+func TestAbsoluteLockTimeByHeight(t *testing.T) {
+	chain, spends := feeChain()
+	locked := blockchain.NewLockedTransaction(spends[0].Inputs, spends[0].Outputs, 1)
+
+	if _, err := chain.TransactionFee(locked); !errors.Is(err, blockchain.ErrLockTimeNotReached) {
+		t.Fatalf("Got %v, expected ErrLockTimeNotReached", err)
+	}
+	if _, err := chain.ProcessBlock(mineChild(chain.GenesisBlock, []blockchain.Transaction{locked})); !errors.Is(err, blockchain.ErrLockTimeNotReached) {
+		t.Fatalf("Got %v, expected ErrLockTimeNotReached", err)
+	}
+
+	if _, err := chain.ProcessBlock(mineChild(chain.GenesisBlock, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.TransactionFee(locked); err != nil {
+		t.Fatalf("Got %v, expected lock time 1 to be final at height 2", err)
+	}
+}
+
+func TestAbsoluteLockTimeByTime(t *testing.T) {
+	chain, spends := feeChain()
+	locked := blockchain.NewLockedTransaction(spends[0].Inputs, spends[0].Outputs, script.LockTimeThreshold+100)
+
+	if _, err := chain.TransactionFee(locked); !errors.Is(err, blockchain.ErrLockTimeNotReached) {
+		t.Fatalf("Got %v, expected ErrLockTimeNotReached", err)
+	}
+}
+
+func TestRelativeLockByHeight(t *testing.T) {
+	chain, spends := feeChain()
+	inputs := []blockchain.TransactionInput{spends[0].Inputs[0]}
+	inputs[0].Sequence = 2
+	locked := blockchain.NewTransaction(inputs, spends[0].Outputs)
+
+	if _, err := chain.TransactionFee(locked); !errors.Is(err, blockchain.ErrSequenceLockNotReached) {
+		t.Fatalf("Got %v, expected ErrSequenceLockNotReached", err)
+	}
+
+	if _, err := chain.ProcessBlock(mineChild(chain.GenesisBlock, nil)); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.TransactionFee(locked); err != nil {
+		t.Fatalf("Got %v, expected output to be 2 blocks deep", err)
+	}
+}
+
+func TestRelativeLockDisabled(t *testing.T) {
+	chain, spends := feeChain()
+	inputs := []blockchain.TransactionInput{spends[0].Inputs[0]}
+	inputs[0].Sequence = script.SequenceLockTimeDisableFlag | 100
+
+	if _, err := chain.TransactionFee(blockchain.NewTransaction(inputs, spends[0].Outputs)); err != nil {
+		t.Fatalf("Got %v, expected nil", err)
+	}
+}
@@ -0,0 +1,144 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrAlreadyInPool              = errors.New("transaction already in pool")
+	ErrMempoolConflict            = errors.New("transaction conflicts with a pooled transaction")
+	ErrInsufficientReplacementFee = errors.New("replacement does not pay more than the transactions it replaces")
+)
+
+type poolEntry struct {
+	transaction Transaction
+	fee         int
+	size        int
+}
+
+// Mempool holds unconfirmed transactions and indexes the outputs they spend
+// so that conflicting transactions are rejected, or replace the pooled ones
+// when ReplaceByFee is set and they pay a higher fee and fee rate.
+type Mempool struct {
+	ReplaceByFee bool
+
+	entries map[string]poolEntry
+	spends  map[OutPoint]string
+	order   []string
+}
+
+func NewMempool(replaceByFee bool) *Mempool {
+	return &Mempool{
+		ReplaceByFee: replaceByFee,
+		entries:      make(map[string]poolEntry),
+		spends:       make(map[OutPoint]string),
+	}
+}
+
+// Add validates t against chain and the pool. It returns the pooled
+// transactions t replaced.
+func (m *Mempool) Add(chain *BlockChain, t Transaction) ([]Transaction, error) {
+	if _, ok := m.entries[t.TXID]; ok {
+		return nil, ErrAlreadyInPool
+	}
+
+	fee, err := chain.TransactionFee(t)
+	if err != nil {
+		return nil, err
+	}
+	entry := poolEntry{transaction: t, fee: fee, size: TransactionSize(t)}
+
+	var conflicts []string
+	seen := make(map[string]bool)
+	for _, input := range t.Inputs {
+		txid, ok := m.spends[input.OutPoint()]
+		if !ok || seen[txid] {
+			continue
+		}
+		if !m.ReplaceByFee {
+			return nil, fmt.Errorf("%w: %s already spent by %s", ErrMempoolConflict, input.OutPoint(), txid)
+		}
+
+		seen[txid] = true
+		conflicts = append(conflicts, txid)
+	}
+
+	conflictFees := 0
+	for _, txid := range conflicts {
+		conflict := m.entries[txid]
+		conflictFees += conflict.fee
+
+		if entry.fee*conflict.size <= conflict.fee*entry.size {
+			return nil, fmt.Errorf("%w: fee rate does not exceed that of %s", ErrInsufficientReplacementFee, txid)
+		}
+	}
+	if len(conflicts) > 0 && entry.fee <= conflictFees {
+		return nil, fmt.Errorf("%w: fee %d <= %d", ErrInsufficientReplacementFee, entry.fee, conflictFees)
+	}
+
+	var replaced []Transaction
+	for _, txid := range conflicts {
+		replaced = append(replaced, m.entries[txid].transaction)
+		m.Remove(txid)
+	}
+
+	m.entries[t.TXID] = entry
+	m.order = append(m.order, t.TXID)
+	for _, input := range t.Inputs {
+		m.spends[input.OutPoint()] = t.TXID
+	}
+
+	return replaced, nil
+}
+
+func (m *Mempool) Remove(txids ...string) {
+	removed := make(map[string]bool)
+
+	for _, txid := range txids {
+		entry, ok := m.entries[txid]
+		if !ok {
+			continue
+		}
+
+		for _, input := range entry.transaction.Inputs {
+			delete(m.spends, input.OutPoint())
+		}
+		delete(m.entries, txid)
+		removed[txid] = true
+	}
+
+	var order []string
+	for _, txid := range m.order {
+		if !removed[txid] {
+			order = append(order, txid)
+		}
+	}
+	m.order = order
+}
+
+// Update evicts every pooled transaction that is no longer valid against
+// chain, i.e. transactions confirmed or double spent by a new block.
+func (m *Mempool) Update(chain *BlockChain) {
+	var evicted []string
+
+	for _, txid := range m.order {
+		if _, err := chain.TransactionFee(m.entries[txid].transaction); err != nil {
+			evicted = append(evicted, txid)
+		}
+	}
+
+	m.Remove(evicted...)
+}
+
+func (m *Mempool) Transactions() []Transaction {
+	transactions := make([]Transaction, 0, len(m.order))
+	for _, txid := range m.order {
+		transactions = append(transactions, m.entries[txid].transaction)
+	}
+	return transactions
+}
+
+func (m *Mempool) Len() int {
+	return len(m.order)
+}
@@ -0,0 +1,97 @@
+package blockchain_test
+
+import (
+	"blockchain"
+	"errors"
+	"testing"
+)
+
+func conflictingSpend(spend blockchain.Transaction, value int) blockchain.Transaction {
+	return blockchain.NewTransaction(spend.Inputs, []blockchain.TransactionOutput{{Value: value, Script: "test --- test OPDup test4 OPEqual"}})
+}
+
+func TestBlockDoubleSpend(t *testing.T) {
+	chain, spends := feeChain()
+	conflict := conflictingSpend(spends[0], 50)
+
+	_, err := chain.ProcessBlock(mineChild(chain.GenesisBlock, []blockchain.Transaction{spends[0], conflict}))
+	if !errors.Is(err, blockchain.ErrDoubleSpend) {
+		t.Fatalf("Got %v, expected ErrDoubleSpend", err)
+	}
+}
+
+func TestTransactionSpendingInputTwice(t *testing.T) {
+	chain, spends := feeChain()
+	input := spends[0].Inputs[0]
+	transaction := blockchain.NewTransaction([]blockchain.TransactionInput{input, input}, []blockchain.TransactionOutput{{Value: 150}})
+
+	if _, err := chain.TransactionFee(transaction); !errors.Is(err, blockchain.ErrDoubleSpend) {
+		t.Fatalf("Got %v, expected ErrDoubleSpend", err)
+	}
+}
+
+func TestMempoolRejectsConflict(t *testing.T) {
+	chain, spends := feeChain()
+	pool := blockchain.NewMempool(false)
+
+	if _, err := pool.Add(&chain, spends[0]); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := pool.Add(&chain, spends[0]); !errors.Is(err, blockchain.ErrAlreadyInPool) {
+		t.Fatalf("Got %v, expected ErrAlreadyInPool", err)
+	}
+	if _, err := pool.Add(&chain, conflictingSpend(spends[0], 10)); !errors.Is(err, blockchain.ErrMempoolConflict) {
+		t.Fatalf("Got %v, expected ErrMempoolConflict", err)
+	}
+	if pool.Len() != 1 {
+		t.Fatalf("pool.Len() == %v, expected 1", pool.Len())
+	}
+}
+
+func TestMempoolReplaceByFee(t *testing.T) {
+	chain, spends := feeChain()
+	pool := blockchain.NewMempool(true)
+
+	if _, err := pool.Add(&chain, spends[0]); err != nil {
+		t.Fatal(err)
+	}
+
+	// spends[0] pays a fee of 10, paying the same is not enough.
+	if _, err := pool.Add(&chain, conflictingSpend(spends[0], 90)); !errors.Is(err, blockchain.ErrInsufficientReplacementFee) {
+		t.Fatalf("Got %v, expected ErrInsufficientReplacementFee", err)
+	}
+
+	replacement := conflictingSpend(spends[0], 80)
+	replaced, err := pool.Add(&chain, replacement)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(replaced) != 1 || replaced[0].TXID != spends[0].TXID {
+		t.Fatalf("Got replaced %v, expected [%s]", replaced, spends[0].TXID)
+	}
+
+	transactions := pool.Transactions()
+	if len(transactions) != 1 || transactions[0].TXID != replacement.TXID {
+		t.Fatalf("Got pool %v, expected only the replacement", transactions)
+	}
+}
+
+func TestMempoolUpdateEvictsConfirmed(t *testing.T) {
+	chain, spends := feeChain()
+	pool := blockchain.NewMempool(false)
+
+	for _, spend := range spends {
+		if _, err := pool.Add(&chain, spend); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if _, err := chain.ProcessBlock(mineChild(chain.GenesisBlock, spends[:1])); err != nil {
+		t.Fatal(err)
+	}
+	pool.Update(&chain)
+
+	if pool.Len() != 2 {
+		t.Fatalf("pool.Len() == %v, expected 2", pool.Len())
+	}
+}
@@ -0,0 +1,32 @@
+package blockchain
+
+import "time"
+
+type Params struct {
+	TargetBlockInterval time.Duration
+	RetargetInterval    int
+	InitialDifficulty   int
+	MinDifficulty       int
+	MaxFutureBlockTime  time.Duration
+	InitialSubsidy      int
+	HalvingInterval     int
+	MaxBlockSize        int
+}
+
+var DefaultParams = Params{
+	TargetBlockInterval: time.Minute,
+	RetargetInterval:    10,
+	InitialDifficulty:   2,
+	MinDifficulty:       1,
+	MaxFutureBlockTime:  2 * time.Hour,
+	InitialSubsidy:      50,
+	HalvingInterval:     10000,
+	MaxBlockSize:        100000,
+}
+
+func (c *BlockChain) params() Params {
+	if c.Params.RetargetInterval == 0 {
+		return DefaultParams
+	}
+	return c.Params
+}
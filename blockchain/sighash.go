@@ -0,0 +1,80 @@
+package blockchain
+
+import (
+	"bytes"
+	"crypto/sha256"
+	"errors"
+	"fmt"
+	"script"
+)
+
+var ErrSigHashSingleOutput = errors.New("SIGHASH_SINGLE input has no matching output")
+
+// SignatureHash is the digest signed by input idx of t spending prevOut. It
+// commits to idx so that a signature cannot be moved to another input
+// spending an identical output.
+// ScriptSig and ScriptArgs are never signed since they carry the signatures
+// themselves.
+// SIGHASH_NONE and SIGHASH_SINGLE leave the other inputs' sequences and the
+// other outputs free to change, SIGHASH_ANYONECANPAY drops the other inputs.
+func SignatureHash(t Transaction, idx int, prevOut TransactionOutput, hashType byte) ([]byte, error) {
+	if idx < 0 || idx >= len(t.Inputs) {
+		return nil, fmt.Errorf("input %d out of range", idx)
+	}
+	if !script.ValidSigHashType(hashType) {
+		return nil, fmt.Errorf("%w: %#x", script.ErrUnknownSigHashType, hashType)
+	}
+
+	base := hashType &^ script.SigHashAnyoneCanPay
+	signed := Transaction{LockTime: t.LockTime}
+
+	for i, input := range t.Inputs {
+		if hashType&script.SigHashAnyoneCanPay != 0 && i != idx {
+			continue
+		}
+
+		input.ScriptSig = ""
+		input.ScriptArgs = nil
+		if i != idx && base != script.SigHashAll {
+			input.Sequence = 0
+		}
+		signed.Inputs = append(signed.Inputs, input)
+	}
+
+	switch base {
+	case script.SigHashAll:
+		signed.Outputs = t.Outputs
+	case script.SigHashSingle:
+		if idx >= len(t.Outputs) {
+			return nil, fmt.Errorf("%w: input %d", ErrSigHashSingleOutput, idx)
+		}
+
+		signed.Outputs = make([]TransactionOutput, idx+1)
+		for i := range signed.Outputs[:idx] {
+			signed.Outputs[i].Value = -1
+		}
+		signed.Outputs[idx] = t.Outputs[idx]
+	}
+
+	var buf bytes.Buffer
+	buf.Write(EncodeTransaction(signed))
+	writeUint32(&buf, uint32(idx))
+	buf.Write(EncodeTransactionOutput(prevOut))
+	buf.WriteByte(hashType)
+
+	hash := sha256.Sum256(buf.Bytes())
+	return hash[:], nil
+}
+
+func (c *BlockChain) SignatureHash(t Transaction, idx int, hashType byte) ([]byte, error) {
+	if idx < 0 || idx >= len(t.Inputs) {
+		return nil, fmt.Errorf("input %d out of range", idx)
+	}
+
+	utxo, ok := c.UTXO.Get(t.Inputs[idx].OutPoint())
+	if !ok {
+		return nil, fmt.Errorf("%w: %s", ErrMissingOutput, t.Inputs[idx].OutPoint())
+	}
+
+	return SignatureHash(t, idx, utxo.Output, hashType)
+}
@@ -0,0 +1,213 @@
+package blockchain_test
+
+import (
+	"blockchain"
+	"bytes"
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"script"
+	"testing"
+)
+
+type signer struct {
+	key    *rsa.PrivateKey
+	pubKey string
+}
+
+func newSigner(t *testing.T) signer {
+	key, err := rsa.GenerateKey(rand.Reader, 1024)
+	if err != nil {
+		t.Fatal(err)
+	}
+	der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+	pubKey := base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))
+
+	return signer{key: key, pubKey: pubKey}
+}
+
+func (s signer) lockingScript() string {
+	return "sign pubKey --- pubKey OPDup OPHash " + script.OPHash(s.pubKey) + " OPEqualVerify sign OPDup pubKey OPDup OPCheckSig"
+}
+
+// sign fills in the ScriptArgs of input idx and recomputes the TXID.
+func (s signer) sign(t *testing.T, chain *blockchain.BlockChain, transaction *blockchain.Transaction, idx int, hashType byte) {
+	digest, err := chain.SignatureHash(*transaction, idx, hashType)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, err := rsa.SignPKCS1v15(nil, s.key, crypto.SHA256, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transaction.Inputs[idx].ScriptArgs = map[string]string{
+		"sign":   script.EncodeSignature(signature, hashType),
+		"pubKey": s.pubKey,
+	}
+	transaction.TXID = transaction.Hash()
+}
+
+func signedChain(t *testing.T) (blockchain.BlockChain, signer) {
+	s := newSigner(t)
+	genesis := blockchain.NewGenesisBlock([]blockchain.Transaction{
+		blockchain.NewTransaction(nil, []blockchain.TransactionOutput{
+			{Value: 100, Script: s.lockingScript()},
+			{Value: 100, Script: s.lockingScript()},
+		}),
+	})
+
+	return blockchain.NewChain(genesis), s
+}
+
+func spendGenesis(chain blockchain.BlockChain, vouts []int, outputs ...blockchain.TransactionOutput) blockchain.Transaction {
+	var inputs []blockchain.TransactionInput
+	for _, vout := range vouts {
+		inputs = append(inputs, blockchain.TransactionInput{TXID: chain.GenesisBlock.Transactions[0].TXID, VOUT: vout})
+	}
+	return blockchain.NewTransaction(inputs, outputs)
+}
+
+func TestSigHashAllCommitsToOutputs(t *testing.T) {
+	chain, s := signedChain(t)
+
+	spend := spendGenesis(chain, []int{0}, blockchain.TransactionOutput{Value: 90, Script: "alice"})
+	s.sign(t, &chain, &spend, 0, script.SigHashAll)
+	if _, err := chain.TransactionFee(spend); err != nil {
+		t.Fatalf("Got %v, expected a signed spend to be valid", err)
+	}
+
+	// Replaying the signature to pay someone else must fail.
+	replayed := spendGenesis(chain, []int{0}, blockchain.TransactionOutput{Value: 90, Script: "mallory"})
+	replayed.Inputs[0].ScriptArgs = spend.Inputs[0].ScriptArgs
+	replayed.TXID = replayed.Hash()
+	if _, err := chain.TransactionFee(replayed); !errors.Is(err, blockchain.ErrScriptFailed) {
+		t.Fatalf("Got %v, expected ErrScriptFailed", err)
+	}
+}
+
+func TestSigHashNoneLeavesOutputsOpen(t *testing.T) {
+	chain, s := signedChain(t)
+
+	spend := spendGenesis(chain, []int{0}, blockchain.TransactionOutput{Value: 90, Script: "alice"})
+	s.sign(t, &chain, &spend, 0, script.SigHashNone)
+
+	spend.Outputs[0].Script = "bob"
+	spend.TXID = spend.Hash()
+	if _, err := chain.TransactionFee(spend); err != nil {
+		t.Fatalf("Got %v, expected SIGHASH_NONE to ignore outputs", err)
+	}
+}
+
+func TestSigHashSingleAnyoneCanPay(t *testing.T) {
+	chain, s := signedChain(t)
+	hashType := script.SigHashSingle | script.SigHashAnyoneCanPay
+
+	spend := spendGenesis(chain, []int{0}, blockchain.TransactionOutput{Value: 90, Script: "alice"})
+	s.sign(t, &chain, &spend, 0, hashType)
+
+	// Anyone may add an input and its own output without breaking input 0.
+	spend.Inputs = append(spend.Inputs, blockchain.TransactionInput{TXID: chain.GenesisBlock.Transactions[0].TXID, VOUT: 1})
+	spend.Outputs = append(spend.Outputs, blockchain.TransactionOutput{Value: 100, Script: "bob"})
+	s.sign(t, &chain, &spend, 1, script.SigHashAll)
+
+	if _, err := chain.TransactionFee(spend); err != nil {
+		t.Fatalf("Got %v, expected input 0 to stay valid", err)
+	}
+
+	spend.Outputs[0].Value = 80
+	spend.TXID = spend.Hash()
+	if _, err := chain.TransactionFee(spend); !errors.Is(err, blockchain.ErrScriptFailed) {
+		t.Fatalf("Got %v, expected changing the matching output to fail", err)
+	}
+}
+
+func TestSigHashCommitsToInputIndex(t *testing.T) {
+	chain, _ := signedChain(t)
+	// Both genesis outputs have the same value and script.
+	spend := spendGenesis(chain, []int{0, 1}, blockchain.TransactionOutput{Value: 90, Script: "alice"}, blockchain.TransactionOutput{Value: 90, Script: "bob"})
+
+	for _, base := range []byte{script.SigHashAll, script.SigHashNone, script.SigHashSingle} {
+		for _, hashType := range []byte{base, base | script.SigHashAnyoneCanPay} {
+			first, err := chain.SignatureHash(spend, 0, hashType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			second, err := chain.SignatureHash(spend, 1, hashType)
+			if err != nil {
+				t.Fatal(err)
+			}
+			if bytes.Equal(first, second) {
+				t.Fatalf("Got the same digest for inputs 0 and 1 with hash type %#x, expected them to differ", hashType)
+			}
+		}
+	}
+}
+
+func TestSigHashSingleWithoutOutput(t *testing.T) {
+	chain, _ := signedChain(t)
+	spend := spendGenesis(chain, []int{0, 1}, blockchain.TransactionOutput{Value: 150})
+
+	if _, err := chain.SignatureHash(spend, 1, script.SigHashSingle); !errors.Is(err, blockchain.ErrSigHashSingleOutput) {
+		t.Fatalf("Got %v, expected ErrSigHashSingleOutput", err)
+	}
+}
+
+func TestTraceUnlock(t *testing.T) {
+	chain, s := signedChain(t)
+	spend := spendGenesis(chain, []int{0}, blockchain.TransactionOutput{Value: 90, Script: "alice"})
+	s.sign(t, &chain, &spend, 0, script.SigHashAll)
+
+	steps, err := chain.TraceUnlock(spend, 0)
+	if err != nil {
+		t.Fatal(err)
+	}
+	last := steps[len(steps)-1]
+	if last.Instruction != "OPCheckSig" || len(last.Stack) != 1 || last.Stack[0] != "1" {
+		t.Fatalf("Last step == %+v, expected OPCheckSig leaving 1", last)
+	}
+
+	// Signing another output set makes OPCheckSig push 0.
+	spend.Outputs[0].Script = "mallory"
+	steps, err = chain.TraceUnlock(spend, 0)
+	if !errors.Is(err, script.ErrEvalFalse) || steps[len(steps)-1].Stack[0] != "0" {
+		t.Fatalf("Got %v, expected OPCheckSig to leave 0", err)
+	}
+}
+
+func TestUnlockingScript(t *testing.T) {
+	s := newSigner(t)
+	genesis := blockchain.NewGenesisBlock([]blockchain.Transaction{
+		blockchain.NewTransaction(nil, []blockchain.TransactionOutput{
+			{Value: 100, Script: script.PayToPubKeyHash(script.OPHash(s.pubKey))},
+		}),
+	})
+	chain := blockchain.NewChain(genesis)
+
+	spend := spendGenesis(chain, []int{0}, blockchain.TransactionOutput{Value: 90, Script: "alice"})
+	txid := spend.TXID
+	digest, err := chain.SignatureHash(spend, 0, script.SigHashAll)
+	if err != nil {
+		t.Fatal(err)
+	}
+	signature, _ := rsa.SignPKCS1v15(nil, s.key, crypto.SHA256, digest)
+	spend.Inputs[0].ScriptSig = script.PubKeyHashSig(script.EncodeSignature(signature, script.SigHashAll), s.pubKey)
+
+	if spend.Hash() != txid {
+		t.Fatalf("Signing changed the TXID")
+	}
+	if err := chain.CheckTransaction(spend); err != nil {
+		t.Fatalf("Got %v, expected the unlocking script to unlock", err)
+	}
+
+	// The block commits to the unlocking data even though the TXID does not.
+	block := mineChild(genesis, []blockchain.Transaction{spend})
+	block.Transactions[0].Inputs[0].ScriptSig = script.PubKeyHashSig(script.EncodeSignature(signature, script.SigHashAll), "other")
+	if _, err := chain.ProcessBlock(block); !errors.Is(err, blockchain.ErrBadMerkleRoot) {
+		t.Fatalf("Got %v, expected ErrBadMerkleRoot", err)
+	}
+}
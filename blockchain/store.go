@@ -0,0 +1,289 @@
+package blockchain
+
+import (
+	"bufio"
+	"encoding/binary"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"hash/crc32"
+	"io"
+	"os"
+	"path/filepath"
+)
+
+type Store interface {
+	Load() ([]StoredBlock, UTXOSet, error)
+	Append(b StoredBlock, utxo UTXOSet) error
+	Reset(blocks []StoredBlock, utxo UTXOSet) error
+	Close() error
+}
+
+type StoredBlock struct {
+	Block Block
+	Undo  BlockUndo
+}
+
+type MemoryStore struct {
+	Blocks []StoredBlock
+	UTXO   UTXOSet
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{}
+}
+
+func (s *MemoryStore) Load() ([]StoredBlock, UTXOSet, error) {
+	if s.UTXO == nil {
+		return s.Blocks, nil, nil
+	}
+	return s.Blocks, s.UTXO.Copy(), nil
+}
+
+func (s *MemoryStore) Append(b StoredBlock, utxo UTXOSet) error {
+	s.Blocks = append(s.Blocks, b)
+	s.UTXO = utxo.Copy()
+	return nil
+}
+
+func (s *MemoryStore) Reset(blocks []StoredBlock, utxo UTXOSet) error {
+	s.Blocks = append([]StoredBlock{}, blocks...)
+	s.UTXO = utxo.Copy()
+	return nil
+}
+
+func (s *MemoryStore) Close() error {
+	return nil
+}
+
+const (
+	blockLogName     = "blocks.log"
+	utxoSnapshotName = "utxo.json"
+	recordHeaderSize = 8
+	maxRecordSize    = 32 << 20
+)
+
+// FileStore keeps blocks in an append-only log of length-prefixed, checksummed
+// records and the UTXO set in a snapshot that is replaced atomically. A record
+// torn by a crash is truncated on the next load.
+type FileStore struct {
+	dir      string
+	log      *os.File
+	readOnly bool
+}
+
+var ErrReadOnlyStore = errors.New("store is opened read-only")
+
+// utxoSnapshot records the tip it was taken at, so a snapshot left behind
+// by a crash during Reset is not mistaken for one of another branch at the
+// same height.
+type utxoSnapshot struct {
+	Height int
+	Tip    [32]byte
+	UTXO   UTXOSet
+}
+
+func OpenFileStore(dir string) (*FileStore, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	log, err := os.OpenFile(filepath.Join(dir, blockLogName), os.O_RDWR|os.O_CREATE|os.O_APPEND, 0o644)
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileStore{dir: dir, log: log}, nil
+}
+
+// OpenFileStoreReadOnly opens an existing store for inspection. Load leaves
+// torn records in place and Append and Reset fail with ErrReadOnlyStore.
+func OpenFileStoreReadOnly(dir string) (*FileStore, error) {
+	log, err := os.Open(filepath.Join(dir, blockLogName))
+	if err != nil {
+		return nil, err
+	}
+
+	return &FileStore{dir: dir, log: log, readOnly: true}, nil
+}
+
+func (s *FileStore) Load() ([]StoredBlock, UTXOSet, error) {
+	if _, err := s.log.Seek(0, io.SeekStart); err != nil {
+		return nil, nil, err
+	}
+
+	var blocks []StoredBlock
+	var offset int64
+	reader := bufio.NewReader(s.log)
+
+	for {
+		payload, err := readRecord(reader)
+		if err == io.EOF {
+			break
+		}
+		if err != nil && s.readOnly {
+			fmt.Printf("Ignoring torn block log record at offset %d: %v\n", offset, err)
+			break
+		}
+		if err != nil {
+			fmt.Printf("Truncating torn block log record at offset %d: %v\n", offset, err)
+			if err := s.log.Truncate(offset); err != nil {
+				return nil, nil, err
+			}
+			break
+		}
+
+		var b StoredBlock
+		if err := json.Unmarshal(payload, &b); err != nil {
+			return nil, nil, fmt.Errorf("decoding block at offset %d: %w", offset, err)
+		}
+
+		blocks = append(blocks, b)
+		offset += int64(recordHeaderSize + len(payload))
+	}
+
+	snapshot, err := s.readSnapshot()
+	if err != nil || len(blocks) == 0 || snapshot.Height != len(blocks)-1 || snapshot.Tip != blocks[len(blocks)-1].Block.Hash() {
+		return blocks, nil, nil
+	}
+
+	return blocks, snapshot.UTXO, nil
+}
+
+func (s *FileStore) Append(b StoredBlock, utxo UTXOSet) error {
+	if s.readOnly {
+		return ErrReadOnlyStore
+	}
+	if err := writeRecord(s.log, b); err != nil {
+		return err
+	}
+	if err := s.log.Sync(); err != nil {
+		return err
+	}
+
+	return s.writeSnapshot(utxoSnapshot{Height: b.Block.Header.Height, Tip: b.Block.Hash(), UTXO: utxo})
+}
+
+func (s *FileStore) Reset(blocks []StoredBlock, utxo UTXOSet) error {
+	if s.readOnly {
+		return ErrReadOnlyStore
+	}
+	path := filepath.Join(s.dir, blockLogName)
+	tmp, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+
+	for _, b := range blocks {
+		if err := writeRecord(tmp, b); err != nil {
+			tmp.Close()
+			return err
+		}
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	s.log.Close()
+	if err := os.Rename(path+".tmp", path); err != nil {
+		return err
+	}
+
+	s.log, err = os.OpenFile(path, os.O_RDWR|os.O_APPEND, 0o644)
+	if err != nil {
+		return err
+	}
+
+	snapshot := utxoSnapshot{Height: len(blocks) - 1, UTXO: utxo}
+	if len(blocks) > 0 {
+		snapshot.Tip = blocks[len(blocks)-1].Block.Hash()
+	}
+	return s.writeSnapshot(snapshot)
+}
+
+func (s *FileStore) Close() error {
+	return s.log.Close()
+}
+
+func (s *FileStore) readSnapshot() (utxoSnapshot, error) {
+	var snapshot utxoSnapshot
+
+	data, err := os.ReadFile(filepath.Join(s.dir, utxoSnapshotName))
+	if err != nil {
+		return snapshot, err
+	}
+
+	err = json.Unmarshal(data, &snapshot)
+	return snapshot, err
+}
+
+func (s *FileStore) writeSnapshot(snapshot utxoSnapshot) error {
+	data, err := json.Marshal(snapshot)
+	if err != nil {
+		return err
+	}
+
+	path := filepath.Join(s.dir, utxoSnapshotName)
+	tmp, err := os.Create(path + ".tmp")
+	if err != nil {
+		return err
+	}
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return err
+	}
+	if err := tmp.Close(); err != nil {
+		return err
+	}
+
+	return os.Rename(path+".tmp", path)
+}
+
+func writeRecord(w io.Writer, b StoredBlock) error {
+	payload, err := json.Marshal(b)
+	if err != nil {
+		return err
+	}
+
+	record := make([]byte, recordHeaderSize+len(payload))
+	binary.BigEndian.PutUint32(record[0:4], uint32(len(payload)))
+	binary.BigEndian.PutUint32(record[4:8], crc32.ChecksumIEEE(payload))
+	copy(record[recordHeaderSize:], payload)
+
+	_, err = w.Write(record)
+	return err
+}
+
+func readRecord(r io.Reader) ([]byte, error) {
+	header := make([]byte, recordHeaderSize)
+	n, err := io.ReadFull(r, header)
+	if n == 0 && err == io.EOF {
+		return nil, io.EOF
+	}
+	if err != nil {
+		return nil, fmt.Errorf("short record header: %w", err)
+	}
+
+	size := binary.BigEndian.Uint32(header[0:4])
+	if size > maxRecordSize {
+		return nil, fmt.Errorf("record length %d exceeds %d", size, maxRecordSize)
+	}
+
+	payload := make([]byte, size)
+	if _, err := io.ReadFull(r, payload); err != nil {
+		return nil, fmt.Errorf("short record payload: %w", err)
+	}
+	if crc32.ChecksumIEEE(payload) != binary.BigEndian.Uint32(header[4:8]) {
+		return nil, errors.New("record checksum mismatch")
+	}
+
+	return payload, nil
+}
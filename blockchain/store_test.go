@@ -0,0 +1,308 @@
+package blockchain_test
+
+import (
+	"blockchain"
+	"errors"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func storeGenesis() blockchain.Block {
+	return blockchain.NewGenesisBlock(
+		[]blockchain.Transaction{
+			blockchain.NewTransaction(
+				[]blockchain.TransactionInput{},
+				[]blockchain.TransactionOutput{
+					{
+						Value:  200,
+						Script: "test --- test OPDup test1 OPEqual",
+					},
+				},
+			),
+		},
+	)
+}
+
+func storeSpend(genesis blockchain.Block) blockchain.Transaction {
+	return blockchain.NewTransaction(
+		[]blockchain.TransactionInput{
+			{
+				TXID:       genesis.Transactions[0].TXID,
+				VOUT:       0,
+				ScriptArgs: map[string]string{"test": "test1"},
+			},
+		},
+		[]blockchain.TransactionOutput{{Value: 150, Script: "test --- test OPDup test2 OPEqual"}},
+	)
+}
+
+func TestFileStoreReload(t *testing.T) {
+	dir := t.TempDir()
+	genesis := storeGenesis()
+
+	store, err := blockchain.OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := blockchain.LoadChain(genesis, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transaction := storeSpend(genesis)
+	if !chain.AddBlock(mine(blockchain.NewBlock(genesis, []blockchain.Transaction{transaction}))) {
+		t.Fatalf("AddBlock failed")
+	}
+	store.Close()
+
+	store, err = blockchain.OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	reloaded, err := blockchain.LoadChain(genesis, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.Chain) != 2 {
+		t.Fatalf("len(reloaded.Chain) == %v, expected 2", len(reloaded.Chain))
+	}
+	if !reloaded.IsUnspent(transaction.TXID, 0) {
+		t.Fatalf("Output %s:0 missing from reloaded UTXO set", transaction.TXID)
+	}
+	if reloaded.IsUnspent(genesis.Transactions[0].TXID, 0) {
+		t.Fatalf("Spent genesis output present in reloaded UTXO set")
+	}
+}
+
+func TestFileStoreTornWrite(t *testing.T) {
+	dir := t.TempDir()
+	genesis := storeGenesis()
+
+	store, err := blockchain.OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := blockchain.LoadChain(genesis, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transaction := storeSpend(genesis)
+	chain.AddBlock(mine(blockchain.NewBlock(genesis, []blockchain.Transaction{transaction})))
+	store.Close()
+
+	// Simulate a crash halfway through appending a third block and before the
+	// UTXO snapshot was replaced.
+	log, err := os.OpenFile(filepath.Join(dir, "blocks.log"), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Write([]byte{0, 0, 1, 0, 1, 2, 3, 4, '{', '"'})
+	log.Close()
+	os.Remove(filepath.Join(dir, "utxo.json"))
+
+	store, err = blockchain.OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	reloaded, err := blockchain.LoadChain(genesis, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(reloaded.Chain) != 2 {
+		t.Fatalf("len(reloaded.Chain) == %v, expected 2", len(reloaded.Chain))
+	}
+	if !reloaded.IsUnspent(transaction.TXID, 0) {
+		t.Fatalf("Output %s:0 missing from rebuilt UTXO set", transaction.TXID)
+	}
+}
+
+func TestLoadChainGenesisMismatch(t *testing.T) {
+	store := blockchain.NewMemoryStore()
+	if _, err := blockchain.LoadChain(storeGenesis(), store); err != nil {
+		t.Fatal(err)
+	}
+
+	other := storeGenesis()
+	other.Header.Nonce = 1
+	if _, err := blockchain.LoadChain(other, store); err == nil {
+		t.Fatalf("Got nil error, expected genesis mismatch")
+	}
+}
+
+func TestFileStoreStaleSnapshot(t *testing.T) {
+	dir := t.TempDir()
+	genesis := storeGenesis()
+
+	store, err := blockchain.OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := blockchain.LoadChain(genesis, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transaction := storeSpend(genesis)
+	chain.AddBlock(mine(blockchain.NewBlock(genesis, []blockchain.Transaction{transaction})))
+	store.Close()
+
+	// A snapshot of another branch at the same height must not be used.
+	err = os.WriteFile(filepath.Join(dir, "utxo.json"), []byte(`{"Height":1,"UTXO":{}}`), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = blockchain.OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	reloaded, err := blockchain.LoadChain(genesis, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded.IsUnspent(transaction.TXID, 0) {
+		t.Fatalf("Output %s:0 missing from rebuilt UTXO set", transaction.TXID)
+	}
+}
+
+func TestFileStoreOversizedRecord(t *testing.T) {
+	dir := t.TempDir()
+	genesis := storeGenesis()
+
+	store, err := blockchain.OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := blockchain.LoadChain(genesis, store); err != nil {
+		t.Fatal(err)
+	}
+	store.Close()
+
+	log, err := os.OpenFile(filepath.Join(dir, "blocks.log"), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Write([]byte{0xff, 0xff, 0xff, 0xff, 1, 2, 3, 4, '{'})
+	log.Close()
+
+	store, err = blockchain.OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	blocks, _, err := store.Load()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(blocks) != 1 {
+		t.Fatalf("len(blocks) == %v, expected 1", len(blocks))
+	}
+}
+
+type failingStore struct {
+	*blockchain.MemoryStore
+	fail bool
+}
+
+func (s *failingStore) Append(b blockchain.StoredBlock, utxo blockchain.UTXOSet) error {
+	if s.fail {
+		return errors.New("disk full")
+	}
+	return s.MemoryStore.Append(b, utxo)
+}
+
+func TestProcessBlockPersistError(t *testing.T) {
+	genesis := storeGenesis()
+	store := &failingStore{MemoryStore: blockchain.NewMemoryStore()}
+	chain, err := blockchain.LoadChain(genesis, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	transaction := storeSpend(genesis)
+	block := mine(blockchain.NewBlock(genesis, []blockchain.Transaction{transaction}))
+
+	store.fail = true
+	if _, err := chain.ProcessBlock(block); err == nil {
+		t.Fatalf("Got nil error, expected the store failure")
+	}
+	if len(chain.Chain) != 1 {
+		t.Fatalf("len(chain.Chain) == %v, expected 1", len(chain.Chain))
+	}
+	if !chain.IsUnspent(genesis.Transactions[0].TXID, 0) {
+		t.Fatalf("Genesis output spent by a block that was not persisted")
+	}
+
+	store.fail = false
+	if _, err := chain.ProcessBlock(block); err != nil {
+		t.Fatalf("Got %v, expected the block to be accepted on retry", err)
+	}
+	if len(store.Blocks) != 2 {
+		t.Fatalf("len(store.Blocks) == %v, expected 2", len(store.Blocks))
+	}
+}
+
+func TestFileStoreReadOnly(t *testing.T) {
+	dir := t.TempDir()
+	genesis := storeGenesis()
+
+	store, err := blockchain.OpenFileStore(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	chain, err := blockchain.LoadChain(genesis, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	transaction := storeSpend(genesis)
+	chain.AddBlock(mine(blockchain.NewBlock(genesis, []blockchain.Transaction{transaction})))
+	store.Close()
+
+	log, err := os.OpenFile(filepath.Join(dir, "blocks.log"), os.O_WRONLY|os.O_APPEND, 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	log.Write([]byte{0, 0, 1, 0, 1, 2, 3, 4, '{', '"'})
+	log.Close()
+	os.Remove(filepath.Join(dir, "utxo.json"))
+
+	before, err := os.ReadFile(filepath.Join(dir, "blocks.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	store, err = blockchain.OpenFileStoreReadOnly(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer store.Close()
+
+	reloaded, err := blockchain.ReadChain(genesis, store)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !reloaded.IsUnspent(transaction.TXID, 0) {
+		t.Fatalf("Output %s:0 missing from rebuilt UTXO set", transaction.TXID)
+	}
+	if err := store.Append(blockchain.StoredBlock{Block: genesis}, reloaded.UTXO); err != blockchain.ErrReadOnlyStore {
+		t.Fatalf("Got %v, expected ErrReadOnlyStore", err)
+	}
+
+	after, err := os.ReadFile(filepath.Join(dir, "blocks.log"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(after) != string(before) {
+		t.Fatalf("Block log changed by a read-only load")
+	}
+	if _, err := os.Stat(filepath.Join(dir, "utxo.json")); !os.IsNotExist(err) {
+		t.Fatalf("Got %v, expected no UTXO snapshot to be written", err)
+	}
+}
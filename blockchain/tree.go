@@ -0,0 +1,249 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+	"math/big"
+	"time"
+)
+
+var (
+	ErrDuplicateBlock = errors.New("block already known")
+	ErrUnknownParent  = errors.New("parent block is unknown")
+)
+
+type blockNode struct {
+	block  Block
+	parent *blockNode
+	work   *big.Int
+}
+
+func BlockWork(difficulty int) *big.Int {
+	return new(big.Int).Lsh(big.NewInt(1), uint(4*difficulty))
+}
+
+func (c *BlockChain) CumulativeWork() *big.Int {
+	c.ensureIndex()
+	return new(big.Int).Set(c.tip.work)
+}
+
+// ensureIndex rebuilds the block tree from the main chain when it is missing
+// or no longer matches it, e.g. after the chain was replaced or decoded.
+func (c *BlockChain) ensureIndex() {
+	if c.tip != nil && len(c.Chain) > 0 && c.tip.block.Hash() == c.Chain[len(c.Chain)-1].Hash() {
+		return
+	}
+
+	c.nodes = make(map[[32]byte]*blockNode)
+	c.tip = nil
+	for _, block := range c.Chain {
+		c.tip = c.addNode(block, c.tip)
+	}
+}
+
+// connectBlock checks b against the current tip and extends the main chain
+// with it.
+func (c *BlockChain) connectBlock(b Block) error {
+	if err := c.checkBlock(b); err != nil {
+		return err
+	}
+
+	c.ensureIndex()
+	c.applyBlock(b)
+	c.Chain = append(c.Chain, b)
+
+	node, ok := c.nodes[b.Hash()]
+	if !ok || node.parent != c.tip {
+		node = c.addNode(b, c.tip)
+	}
+	c.tip = node
+
+	return nil
+}
+
+// disconnectTo rolls the main chain back to height using the undo data of
+// each removed block, and returns the removed blocks in chain order.
+func (c *BlockChain) disconnectTo(height int) ([]Block, error) {
+	for _, block := range c.Chain[height+1:] {
+		if _, ok := c.undo[block.Hash()]; !ok {
+			return nil, fmt.Errorf("%w %x", ErrMissingUndo, block.Hash())
+		}
+	}
+
+	var disconnected []Block
+	for len(c.Chain)-1 > height {
+		block := c.Chain[len(c.Chain)-1]
+		hash := block.Hash()
+
+		c.UTXO.revert(c.undo[hash])
+		delete(c.undo, hash)
+		c.Chain = c.Chain[:len(c.Chain)-1]
+		disconnected = append([]Block{block}, disconnected...)
+	}
+	c.tip = c.nodes[c.Chain[len(c.Chain)-1].Hash()]
+
+	return disconnected, nil
+}
+
+func (c *BlockChain) addNode(b Block, parent *blockNode) *blockNode {
+	node := &blockNode{block: b, parent: parent, work: BlockWork(b.Header.Difficulty)}
+	if parent != nil {
+		node.work.Add(node.work, parent.work)
+	}
+
+	c.nodes[b.Hash()] = node
+	return node
+}
+
+func (c *BlockChain) isMainChain(node *blockNode) bool {
+	height := node.block.Header.Height
+	return height < len(c.Chain) && c.Chain[height].Hash() == node.block.Hash()
+}
+
+// ProcessBlock adds b to the block tree. Blocks extending the tip are
+// connected directly, blocks on a side branch are kept and trigger a
+// reorganization once their branch has more cumulative work than the main
+// chain. The transactions of blocks disconnected by a reorganization are
+// returned so they can go back to the transaction pool.
+func (c *BlockChain) ProcessBlock(b Block) ([]Transaction, error) {
+	c.ensureIndex()
+
+	hash := b.Hash()
+	if _, ok := c.nodes[hash]; ok {
+		return nil, ErrDuplicateBlock
+	}
+
+	parent, ok := c.nodes[b.Header.PrevBlockHash]
+	if !ok {
+		return nil, ErrUnknownParent
+	}
+
+	maxTime := time.Now().Add(c.params().MaxFutureBlockTime).Unix()
+	if b.Header.Time > maxTime {
+		return nil, ErrFutureBlock
+	}
+
+	if parent == c.tip {
+		if err := c.connectBlock(b); err != nil {
+			return nil, err
+		}
+
+		// Keep memory in step with the store: a block that could not be
+		// written is disconnected again so it can be retried.
+		if err := c.persistBlock(b); err != nil {
+			if _, undoErr := c.disconnectTo(parent.block.Header.Height); undoErr != nil {
+				return nil, fmt.Errorf("%w; disconnecting it: %w", err, undoErr)
+			}
+			c.removeBranch(c.nodes[hash])
+			return nil, err
+		}
+
+		return nil, nil
+	}
+
+	if err := c.checkHeader(b, parent); err != nil {
+		return nil, err
+	}
+
+	node := c.addNode(b, parent)
+	if node.work.Cmp(c.tip.work) <= 0 {
+		fmt.Printf("Stored side branch block %x at height %d\n", hash, b.Header.Height)
+		return nil, nil
+	}
+
+	return c.reorganize(node)
+}
+
+func (c *BlockChain) reorganize(newTip *blockNode) ([]Transaction, error) {
+	var branch []*blockNode
+	fork := newTip
+	for !c.isMainChain(fork) {
+		branch = append([]*blockNode{fork}, branch...)
+		fork = fork.parent
+	}
+
+	forkHeight := fork.block.Header.Height
+	oldHeight := len(c.Chain) - 1
+
+	disconnected, err := c.disconnectTo(forkHeight)
+	if err != nil {
+		return nil, err
+	}
+
+	for _, node := range branch {
+		if err := c.connectBlock(node.block); err != nil {
+			c.removeBranch(node)
+			invalid := &ValidationError{Height: node.block.Header.Height, Hash: node.block.Hash(), Err: err}
+
+			if _, err := c.disconnectTo(forkHeight); err != nil {
+				return nil, fmt.Errorf("%w, restoring the previous chain: %w", invalid, err)
+			}
+			for _, block := range disconnected {
+				if err := c.connectBlock(block); err != nil {
+					return nil, fmt.Errorf("%w, reconnecting block %x: %w", invalid, block.Hash(), err)
+				}
+			}
+
+			return nil, invalid
+		}
+	}
+
+	var connected []Block
+	for _, node := range branch {
+		connected = append(connected, node.block)
+	}
+	orphaned := orphanedTransactions(disconnected, connected)
+
+	fmt.Printf("Reorganized from height %d to %d at fork height %d\n", oldHeight, newTip.block.Header.Height, forkHeight)
+
+	if c.Store != nil {
+		if err := c.Store.Reset(c.storedBlocks(), c.UTXO); err != nil {
+			fmt.Printf("Error persisting reorganized chain: %v\n", err)
+		}
+	}
+
+	return orphaned, nil
+}
+
+// orphanedTransactions returns the transactions of the disconnected blocks
+// that the connected ones do not include. Coinbases are left out since they
+// are only valid in their own block.
+func orphanedTransactions(disconnected []Block, connected []Block) []Transaction {
+	included := make(map[string]bool)
+	for _, block := range connected {
+		for _, transaction := range block.Transactions {
+			included[transaction.TXID] = true
+		}
+	}
+
+	var orphaned []Transaction
+	for _, block := range disconnected {
+		for _, transaction := range block.Transactions {
+			if !transaction.IsCoinbase() && !included[transaction.TXID] {
+				orphaned = append(orphaned, transaction)
+			}
+		}
+	}
+	return orphaned
+}
+
+// removeBranch drops node and every known descendant from the block tree.
+func (c *BlockChain) removeBranch(node *blockNode) {
+	invalid := map[*blockNode]bool{node: true}
+
+	for changed := true; changed; {
+		changed = false
+		for _, candidate := range c.nodes {
+			if !invalid[candidate] && invalid[candidate.parent] {
+				invalid[candidate] = true
+				changed = true
+			}
+		}
+	}
+
+	for hash, candidate := range c.nodes {
+		if invalid[candidate] {
+			delete(c.nodes, hash)
+		}
+	}
+}
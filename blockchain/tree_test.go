@@ -0,0 +1,112 @@
+package blockchain_test
+
+import (
+	"blockchain"
+	"errors"
+	"testing"
+)
+
+func TestForkReorganization(t *testing.T) {
+	genesis := storeGenesis()
+	chain := blockchain.NewChain(genesis)
+
+	spendA := storeSpend(genesis)
+	spendB := blockchain.NewTransaction(spendA.Inputs, []blockchain.TransactionOutput{{Value: 100, Script: "test --- test OPDup test3 OPEqual"}})
+
+	coinbase := blockchain.NewCoinbaseTransaction(1, chain.Subsidy(1), minerScript)
+	blockA1 := mineChild(genesis, []blockchain.Transaction{coinbase, spendA})
+	blockB1 := mineChild(genesis, []blockchain.Transaction{spendB})
+
+	if orphaned, err := chain.ProcessBlock(blockA1); err != nil || len(orphaned) != 0 {
+		t.Fatalf("ProcessBlock(blockA1) == %v, %v, expected no orphans and no error", orphaned, err)
+	}
+
+	// Equal work at the same height keeps the first block seen.
+	if _, err := chain.ProcessBlock(blockB1); err != nil {
+		t.Fatalf("Got %v, expected nil", err)
+	}
+	if chain.Chain[1].Hash() != blockA1.Hash() {
+		t.Fatalf("Tip switched to side branch with equal work")
+	}
+
+	blockB2 := mineChild(blockB1, []blockchain.Transaction{})
+	orphaned, err := chain.ProcessBlock(blockB2)
+	if err != nil {
+		t.Fatalf("Got %v, expected nil", err)
+	}
+
+	if len(chain.Chain) != 3 || chain.Chain[2].Hash() != blockB2.Hash() {
+		t.Fatalf("Chain did not reorganize onto the heavier branch")
+	}
+	if len(orphaned) != 1 || orphaned[0].TXID != spendA.TXID {
+		t.Fatalf("Got orphaned %v, expected [%s] without the coinbase", orphaned, spendA.TXID)
+	}
+	if chain.IsUnspent(spendA.TXID, 0) || !chain.IsUnspent(spendB.TXID, 0) {
+		t.Fatalf("UTXO set does not reflect the new branch")
+	}
+	if err := chain.Validate(); err != nil {
+		t.Fatalf("Got %v, expected nil", err)
+	}
+}
+
+func TestForkRejectsInvalidBranch(t *testing.T) {
+	genesis := storeGenesis()
+	chain := blockchain.NewChain(genesis)
+
+	spend := storeSpend(genesis)
+	if _, err := chain.ProcessBlock(mineChild(genesis, []blockchain.Transaction{spend})); err != nil {
+		t.Fatal(err)
+	}
+
+	overspend := blockchain.NewTransaction(spend.Inputs, []blockchain.TransactionOutput{{Value: 500}})
+	sideBlock := mineChild(genesis, []blockchain.Transaction{overspend})
+	if _, err := chain.ProcessBlock(sideBlock); err != nil {
+		t.Fatalf("Got %v, expected side branch to be stored", err)
+	}
+
+	_, err := chain.ProcessBlock(mineChild(sideBlock, []blockchain.Transaction{}))
+	if !errors.Is(err, blockchain.ErrOutputsExceedInput) {
+		t.Fatalf("Got %v, expected ErrOutputsExceedInput", err)
+	}
+	if !chain.IsUnspent(spend.TXID, 0) || len(chain.Chain) != 2 {
+		t.Fatalf("Main chain changed after a failed reorganization")
+	}
+}
+
+func TestProcessBlockUnknownParent(t *testing.T) {
+	genesis := storeGenesis()
+	chain := blockchain.NewChain(genesis)
+
+	orphan := mine(blockchain.NewBlock(blockchain.NewBlock(genesis, nil), nil))
+	if _, err := chain.ProcessBlock(orphan); !errors.Is(err, blockchain.ErrUnknownParent) {
+		t.Fatalf("Got %v, expected ErrUnknownParent", err)
+	}
+}
+
+func TestReplaceReturnsOrphans(t *testing.T) {
+	genesis := storeGenesis()
+	spendA := storeSpend(genesis)
+	spendB := blockchain.NewTransaction(spendA.Inputs, []blockchain.TransactionOutput{{Value: 100, Script: "test --- test OPDup test3 OPEqual"}})
+
+	chain := blockchain.NewChain(genesis)
+	coinbase := blockchain.NewCoinbaseTransaction(1, chain.Subsidy(1), minerScript)
+	if _, err := chain.ProcessBlock(mineChild(genesis, []blockchain.Transaction{coinbase, spendA})); err != nil {
+		t.Fatal(err)
+	}
+
+	other := blockchain.NewChain(genesis)
+	blockB1 := mineChild(genesis, []blockchain.Transaction{spendB})
+	for _, block := range []blockchain.Block{blockB1, mineChild(blockB1, nil)} {
+		if _, err := other.ProcessBlock(block); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	orphaned, err := chain.Replace(other)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(orphaned) != 1 || orphaned[0].TXID != spendA.TXID {
+		t.Fatalf("Got orphaned %v, expected [%s] without the coinbase", orphaned, spendA.TXID)
+	}
+}
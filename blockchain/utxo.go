@@ -0,0 +1,160 @@
+package blockchain
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"script"
+	"strconv"
+	"strings"
+)
+
+var ErrMissingUndo = errors.New("no undo data for block")
+
+type OutPoint struct {
+	TXID  string
+	Index int
+}
+
+func (o OutPoint) String() string {
+	return fmt.Sprintf("%s:%d", o.TXID, o.Index)
+}
+
+func (o OutPoint) MarshalText() ([]byte, error) {
+	return []byte(o.String()), nil
+}
+
+func (o *OutPoint) UnmarshalText(text []byte) error {
+	txid, index, ok := strings.Cut(string(text), ":")
+	if !ok {
+		return fmt.Errorf("invalid outpoint %q", text)
+	}
+
+	idx, err := strconv.Atoi(index)
+	if err != nil {
+		return fmt.Errorf("invalid outpoint %q: %w", text, err)
+	}
+
+	o.TXID = txid
+	o.Index = idx
+	return nil
+}
+
+func (input *TransactionInput) OutPoint() OutPoint {
+	return OutPoint{TXID: input.TXID, Index: input.VOUT}
+}
+
+type UTXOEntry struct {
+	Output TransactionOutput
+	Height int
+	Spent  bool
+}
+
+// UTXOSet maps every output created on the main chain to its entry. Spending
+// an output only marks it, so indexes never shift and the entry can be
+// restored when its spending block is disconnected.
+type UTXOSet map[OutPoint]*UTXOEntry
+
+// BlockUndo keeps the entries a block spent, so they can be restored when
+// the block is disconnected, and the outputs it created.
+type BlockUndo struct {
+	Spent   map[OutPoint]UTXOEntry
+	Created []OutPoint
+}
+
+// ScriptAddress is the address funds locked by script are found at. Sending
+// to script.PayToScriptHash(ScriptAddress(s)) locks them under s as well.
+func ScriptAddress(script string) string {
+	hash := sha256.Sum256([]byte(script))
+	return hex.EncodeToString(hash[:])
+}
+
+func (u UTXOSet) Get(o OutPoint) (UTXOEntry, bool) {
+	entry, ok := u[o]
+	if !ok || entry.Spent {
+		return UTXOEntry{}, false
+	}
+	return *entry, true
+}
+
+func (u UTXOSet) FindByScript(script string) map[OutPoint]UTXOEntry {
+	res := make(map[OutPoint]UTXOEntry)
+	for outPoint, entry := range u {
+		if !entry.Spent && entry.Output.Script == script {
+			res[outPoint] = *entry
+		}
+	}
+	return res
+}
+
+func (u UTXOSet) FindByAddress(address string) map[OutPoint]UTXOEntry {
+	res := make(map[OutPoint]UTXOEntry)
+	for outPoint, entry := range u {
+		if entry.Spent {
+			continue
+		}
+		if p2sh, ok := script.IsPayToScriptHash(entry.Output.Script); (ok && p2sh == address) || ScriptAddress(entry.Output.Script) == address {
+			res[outPoint] = *entry
+		}
+	}
+	return res
+}
+
+// Unspent returns the entries that have not been marked spent.
+func (u UTXOSet) Unspent() map[OutPoint]UTXOEntry {
+	res := make(map[OutPoint]UTXOEntry)
+	for outPoint, entry := range u {
+		if !entry.Spent {
+			res[outPoint] = *entry
+		}
+	}
+	return res
+}
+
+func (u UTXOSet) Copy() UTXOSet {
+	res := make(UTXOSet, len(u))
+	for outPoint, entry := range u {
+		copied := *entry
+		res[outPoint] = &copied
+	}
+	return res
+}
+
+func (u UTXOSet) apply(b Block) BlockUndo {
+	undo := BlockUndo{Spent: make(map[OutPoint]UTXOEntry)}
+
+	for _, transaction := range b.Transactions {
+		if !transaction.IsCoinbase() {
+			for _, input := range transaction.Inputs {
+				entry, ok := u[input.OutPoint()]
+				if !ok || entry.Spent {
+					continue
+				}
+
+				undo.Spent[input.OutPoint()] = *entry
+				entry.Spent = true
+			}
+		}
+
+		for idx, output := range transaction.Outputs {
+			outPoint := OutPoint{TXID: transaction.TXID, Index: idx}
+			u[outPoint] = &UTXOEntry{Output: output, Height: b.Header.Height}
+			undo.Created = append(undo.Created, outPoint)
+		}
+	}
+
+	return undo
+}
+
+func (u UTXOSet) revert(undo BlockUndo) {
+	for _, outPoint := range undo.Created {
+		delete(u, outPoint)
+	}
+
+	for outPoint, entry := range undo.Spent {
+		restored := entry
+		restored.Spent = false
+		u[outPoint] = &restored
+	}
+}
@@ -0,0 +1,108 @@
+package blockchain_test
+
+import (
+	"blockchain"
+	"encoding/json"
+	"testing"
+)
+
+func TestSpendKeepsOutputIndexes(t *testing.T) {
+	chain, spends := feeChain()
+
+	if _, err := chain.ProcessBlock(mineChild(chain.GenesisBlock, spends[:1])); err != nil {
+		t.Fatal(err)
+	}
+
+	// Spending VOUT 0 used to shift VOUT 2 out of range.
+	block := mineChild(chain.Chain[1], spends[2:])
+	if _, err := chain.ProcessBlock(block); err != nil {
+		t.Fatalf("Got %v, expected VOUT 2 to stay spendable", err)
+	}
+	if !chain.IsUnspent(chain.GenesisBlock.Transactions[0].TXID, 1) {
+		t.Fatalf("VOUT 1 not spendable after spending its siblings")
+	}
+}
+
+func TestFindByScriptAndAddress(t *testing.T) {
+	chain, spends := feeChain()
+	script := chain.GenesisBlock.Transactions[0].Outputs[0].Script
+
+	if _, err := chain.ProcessBlock(mineChild(chain.GenesisBlock, spends[:1])); err != nil {
+		t.Fatal(err)
+	}
+
+	// Two genesis outputs are left, plus the output of spends[0].
+	if found := chain.UTXO.FindByScript(script); len(found) != 3 {
+		t.Fatalf("len(FindByScript()) == %v, expected 3", len(found))
+	}
+	if found := chain.UTXO.FindByAddress(blockchain.ScriptAddress(script)); len(found) != 3 {
+		t.Fatalf("len(FindByAddress()) == %v, expected 3", len(found))
+	}
+	if found := chain.UTXO.FindByScript("unknown"); len(found) != 0 {
+		t.Fatalf("len(FindByScript()) == %v, expected 0", len(found))
+	}
+}
+
+func TestUTXOSetJSONRoundTrip(t *testing.T) {
+	chain, _ := feeChain()
+
+	data, err := json.Marshal(chain.UTXO)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var decoded blockchain.UTXOSet
+	if err := json.Unmarshal(data, &decoded); err != nil {
+		t.Fatal(err)
+	}
+
+	outPoint := blockchain.OutPoint{TXID: chain.GenesisBlock.Transactions[0].TXID, Index: 2}
+	entry, ok := decoded.Get(outPoint)
+	if !ok || entry.Output.Value != 100 {
+		t.Fatalf("decoded.Get(%s) == %v, %v, expected value 100", outPoint, entry, ok)
+	}
+}
+
+func TestReorganizationRestoresSpentOutputs(t *testing.T) {
+	chain, spends := feeChain()
+	genesis := chain.GenesisBlock
+
+	if _, err := chain.ProcessBlock(mineChild(genesis, spends[:1])); err != nil {
+		t.Fatal(err)
+	}
+
+	sideBlock := mineChild(genesis, spends[1:2])
+	if _, err := chain.ProcessBlock(sideBlock); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := chain.ProcessBlock(mineChild(sideBlock, nil)); err != nil {
+		t.Fatal(err)
+	}
+
+	genesisTXID := genesis.Transactions[0].TXID
+	if !chain.IsUnspent(genesisTXID, 0) || chain.IsUnspent(genesisTXID, 1) {
+		t.Fatalf("UTXO set not rolled back onto the side branch")
+	}
+	if chain.IsUnspent(spends[0].TXID, 0) {
+		t.Fatalf("Output of disconnected block still spendable")
+	}
+}
+
+func TestSpentOutputsMarked(t *testing.T) {
+	chain, spends := feeChain()
+
+	if _, err := chain.ProcessBlock(mineChild(chain.GenesisBlock, spends[:1])); err != nil {
+		t.Fatal(err)
+	}
+
+	spent := blockchain.OutPoint{TXID: chain.GenesisBlock.Transactions[0].TXID, Index: 0}
+	if entry, ok := chain.UTXO[spent]; !ok || !entry.Spent {
+		t.Fatalf("Output %s not marked spent", spent)
+	}
+	if _, ok := chain.UTXO.Get(spent); ok {
+		t.Fatalf("Spent output %s returned by Get", spent)
+	}
+	if unspent := chain.UTXO.Unspent(); len(unspent) != 3 {
+		t.Fatalf("len(chain.UTXO.Unspent()) == %v, expected 3", len(unspent))
+	}
+}
@@ -0,0 +1,188 @@
+package blockchain
+
+import (
+	"errors"
+	"fmt"
+)
+
+var (
+	ErrEmptyChain         = errors.New("chain has no blocks")
+	ErrGenesisMismatch    = errors.New("genesis block does not match")
+	ErrBadLinkage         = errors.New("previous block hash does not match parent")
+	ErrBadHeight          = errors.New("height does not follow parent")
+	ErrBadMerkleRoot      = errors.New("merkle root does not match transactions")
+	ErrBadProofOfWork     = errors.New("hash does not meet difficulty")
+	ErrBadTXID            = errors.New("transaction id does not match contents")
+	ErrMissingOutput      = errors.New("input references a missing or spent output")
+	ErrScriptFailed       = errors.New("input script evaluation failed")
+	ErrOutputsExceedInput = errors.New("outputs exceed inputs")
+	ErrDoubleSpend        = errors.New("output is spent more than once")
+)
+
+type ValidationError struct {
+	Height int
+	Hash   [32]byte
+	Err    error
+}
+
+func (e *ValidationError) Error() string {
+	return fmt.Sprintf("invalid block %d (%x): %v", e.Height, e.Hash, e.Err)
+}
+
+func (e *ValidationError) Unwrap() error {
+	return e.Err
+}
+
+// Validate replays the whole chain from the genesis block into a fresh UTXO
+// set and reports the first block that breaks a consensus rule.
+func (c *BlockChain) Validate() error {
+	if len(c.Chain) == 0 {
+		return &ValidationError{Err: ErrEmptyChain}
+	}
+
+	genesis := c.Chain[0]
+	if genesis.Hash() != c.GenesisBlock.Hash() {
+		return &ValidationError{Height: 0, Hash: genesis.Hash(), Err: ErrGenesisMismatch}
+	}
+
+	replay := NewChain(c.GenesisBlock)
+	replay.Params = c.Params
+	for _, block := range c.Chain[1:] {
+		if err := replay.connectBlock(block); err != nil {
+			return &ValidationError{Height: block.Header.Height, Hash: block.Hash(), Err: err}
+		}
+	}
+
+	return nil
+}
+
+func (c *BlockChain) checkHeader(b Block, parent *blockNode) error {
+	if b.Header.PrevBlockHash != parent.block.Hash() {
+		return ErrBadLinkage
+	}
+	if b.Header.Height != parent.block.Header.Height+1 {
+		return ErrBadHeight
+	}
+	if b.Header.Time <= medianTimePast(parent) {
+		return ErrBadTimestamp
+	}
+	if b.Header.Difficulty != c.requiredDifficulty(parent) {
+		return ErrBadDifficulty
+	}
+	if b.Header.MerkleRoot != MerkleRoot(b.Transactions) {
+		return ErrBadMerkleRoot
+	}
+	if !b.IsValid() {
+		return ErrBadProofOfWork
+	}
+
+	return nil
+}
+
+func (c *BlockChain) checkBlock(b Block) error {
+	c.ensureIndex()
+	if err := c.checkHeader(b, c.tip); err != nil {
+		return err
+	}
+	if err := checkBlockSize(b, c.params().MaxBlockSize); err != nil {
+		return err
+	}
+
+	ctx := lockContext{height: b.Header.Height, time: medianTimePast(c.tip)}
+	fees := 0
+	spentBy := make(map[OutPoint]int)
+	for idx, transaction := range b.Transactions {
+		if transaction.TXID != transaction.Hash() {
+			return fmt.Errorf("transaction %d: %w", idx, ErrBadTXID)
+		}
+		if transaction.IsCoinbase() {
+			if idx != 0 {
+				return fmt.Errorf("transaction %d: %w", idx, ErrMisplacedCoinbase)
+			}
+			continue
+		}
+
+		for _, input := range transaction.Inputs {
+			outPoint := input.OutPoint()
+			if other, ok := spentBy[outPoint]; ok {
+				return fmt.Errorf("transaction %d: %w: %s already spent by transaction %d", idx, ErrDoubleSpend, outPoint, other)
+			}
+			spentBy[outPoint] = idx
+		}
+
+		fee, err := c.transactionFee(transaction, ctx)
+		if err != nil {
+			return fmt.Errorf("transaction %d: %w", idx, err)
+		}
+		fees += fee
+		if fees > MaxMoney {
+			return fmt.Errorf("transaction %d: %w: total fees", idx, ErrValueOutOfRange)
+		}
+	}
+
+	if len(b.Transactions) > 0 && b.Transactions[0].IsCoinbase() {
+		if err := checkCoinbase(b, c.Subsidy(b.Header.Height), fees); err != nil {
+			return fmt.Errorf("transaction 0: %w", err)
+		}
+	}
+
+	return nil
+}
+
+func (c *BlockChain) CheckTransaction(t Transaction) error {
+	_, err := c.TransactionFee(t)
+	return err
+}
+
+// TransactionFee validates t against the UTXO set for inclusion in the next
+// block and returns the value of its inputs left unclaimed by its outputs.
+func (c *BlockChain) TransactionFee(t Transaction) (int, error) {
+	return c.transactionFee(t, c.nextLockContext())
+}
+
+func (c *BlockChain) transactionFee(t Transaction, ctx lockContext) (int, error) {
+	balance := 0
+
+	if t.IsCoinbase() {
+		return 0, ErrCoinbaseOutsideBlock
+	}
+	if err := checkLockTime(t, ctx); err != nil {
+		return 0, err
+	}
+
+	spent := make(map[OutPoint]bool)
+	for idx, input := range t.Inputs {
+		if spent[input.OutPoint()] {
+			return 0, fmt.Errorf("input %d (%s): %w", idx, input.OutPoint(), ErrDoubleSpend)
+		}
+		spent[input.OutPoint()] = true
+
+		if !c.IsUnspent(input.TXID, input.VOUT) {
+			return 0, fmt.Errorf("input %d (%s:%d): %w", idx, input.TXID, input.VOUT, ErrMissingOutput)
+		}
+
+		if err := c.checkSequenceLock(input, ctx); err != nil {
+			return 0, fmt.Errorf("input %d (%s): %w", idx, input.OutPoint(), err)
+		}
+
+		val, err := c.Unlock(t, idx)
+		if err != nil {
+			return 0, fmt.Errorf("input %d (%s:%d): %w: %w", idx, input.TXID, input.VOUT, ErrScriptFailed, err)
+		}
+		balance += val
+		if balance > MaxMoney {
+			return 0, fmt.Errorf("input %d: %w: total input value", idx, ErrValueOutOfRange)
+		}
+	}
+
+	totalSpent, err := sumOutputs(t.Outputs)
+	if err != nil {
+		return 0, err
+	}
+
+	if totalSpent > balance {
+		return 0, fmt.Errorf("%w: %d > %d", ErrOutputsExceedInput, totalSpent, balance)
+	}
+
+	return balance - totalSpent, nil
+}
@@ -0,0 +1,120 @@
+package blockchain_test
+
+import (
+	"blockchain"
+	"errors"
+	"script"
+	"testing"
+)
+
+func validChain(t *testing.T) (blockchain.BlockChain, blockchain.Transaction) {
+	genesis := storeGenesis()
+	chain := blockchain.NewChain(genesis)
+
+	transaction := storeSpend(genesis)
+	if !chain.AddBlock(mineChild(genesis, []blockchain.Transaction{transaction})) {
+		t.Fatalf("AddBlock failed")
+	}
+
+	return chain, transaction
+}
+
+func TestValidateSuccess(t *testing.T) {
+	chain, _ := validChain(t)
+
+	if err := chain.Validate(); err != nil {
+		t.Fatalf("Got %v, expected nil", err)
+	}
+}
+
+func TestValidateBadLinkage(t *testing.T) {
+	chain, _ := validChain(t)
+	chain.Chain[1].Header.PrevBlockHash = [32]byte{1}
+	chain.Chain[1] = mine(chain.Chain[1])
+
+	assertValidationError(t, chain.Validate(), 1, blockchain.ErrBadLinkage)
+}
+
+func TestValidateBadMerkleRoot(t *testing.T) {
+	chain, _ := validChain(t)
+	chain.Chain[1].Transactions = nil
+
+	assertValidationError(t, chain.Validate(), 1, blockchain.ErrBadMerkleRoot)
+}
+
+func TestValidateReplaysUTXO(t *testing.T) {
+	chain, transaction := validChain(t)
+
+	// Spending the genesis output a second time is only detectable by
+	// replaying the chain, every header on its own is well formed.
+	doubleSpend := mineChild(chain.Chain[1], []blockchain.Transaction{transaction})
+	chain.Chain = append(chain.Chain, doubleSpend)
+
+	assertValidationError(t, chain.Validate(), 2, blockchain.ErrMissingOutput)
+}
+
+func TestReplaceRebuildsUTXO(t *testing.T) {
+	chain, transaction := validChain(t)
+
+	// A peer can send any UTXO set along with valid blocks.
+	forged := chain
+	forgedOutPoint := blockchain.OutPoint{TXID: "forged", Index: 0}
+	forged.UTXO = blockchain.UTXOSet{forgedOutPoint: {Output: blockchain.TransactionOutput{Value: 1000000, Script: "mallory"}}}
+
+	replaced := blockchain.NewChain(chain.GenesisBlock)
+	if _, err := replaced.Replace(forged); err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := replaced.UTXO[forgedOutPoint]; ok {
+		t.Fatalf("Replace kept the peer's UTXO set")
+	}
+	if !replaced.IsUnspent(transaction.TXID, 0) {
+		t.Fatalf("Replace did not rebuild the UTXO set from the blocks")
+	}
+}
+
+func TestValidateGenesisMismatch(t *testing.T) {
+	chain, _ := validChain(t)
+	chain.GenesisBlock.Header.Nonce = 1
+
+	assertValidationError(t, chain.Validate(), 0, blockchain.ErrGenesisMismatch)
+}
+
+func assertValidationError(t *testing.T, err error, height int, reason error) {
+	t.Helper()
+
+	var validationErr *blockchain.ValidationError
+	if !errors.As(err, &validationErr) {
+		t.Fatalf("Got %v, expected *ValidationError", err)
+	}
+	if validationErr.Height != height {
+		t.Fatalf("validationErr.Height == %v, expected %v", validationErr.Height, height)
+	}
+	if !errors.Is(err, reason) {
+		t.Fatalf("Got %v, expected %v", err, reason)
+	}
+}
+
+func TestTransactionScriptFailureReason(t *testing.T) {
+	chain, spends := feeChain()
+	transaction := spends[0]
+	transaction.Inputs = []blockchain.TransactionInput{transaction.Inputs[0]}
+	transaction.Inputs[0].ScriptArgs = map[string]string{"other": "test1"}
+	transaction.TXID = transaction.Hash()
+
+	err := chain.CheckTransaction(transaction)
+	if !errors.Is(err, blockchain.ErrScriptFailed) || !errors.Is(err, script.ErrMissingArg) {
+		t.Fatalf("Got %v, expected ErrScriptFailed and ErrMissingArg", err)
+	}
+
+	var evalErr *script.EvalError
+	if !errors.As(err, &evalErr) || evalErr.Instruction != "OPDup" {
+		t.Fatalf("Got %v, expected the failing instruction to be OPDup", err)
+	}
+
+	transaction.Inputs[0].ScriptArgs = map[string]string{"test": "test2"}
+	transaction.TXID = transaction.Hash()
+	if err := chain.CheckTransaction(transaction); !errors.Is(err, script.ErrEvalFalse) {
+		t.Fatalf("Got %v, expected ErrEvalFalse", err)
+	}
+}
@@ -4,35 +4,44 @@ import (
 	"blockchain"
 	"bytes"
 	"encoding/json"
+	"errors"
 	"fmt"
 	"github.com/gin-gonic/gin"
 	"github.com/robfig/cron"
 	"io"
 	"net/http"
-	"time"
+	"oracle"
+	"script"
 )
 
 type Client struct {
 	Router          *gin.Engine
 	Scheduler       *cron.Cron
 	BlockChain      *blockchain.BlockChain
-	TransactionPool []blockchain.Transaction
+	TransactionPool *blockchain.Mempool
 	Peers           []string
+	MinerScript     string
+	Oracle          *oracle.Oracle
+	OracleSource    oracle.Source
 }
 
-func NewClient(chain *blockchain.BlockChain, peers []string) Client {
-	client := Client{
-		Router:     gin.Default(),
-		BlockChain: chain,
-		Scheduler:  cron.New(),
-		Peers:      peers,
+func NewClient(chain *blockchain.BlockChain, peers []string) *Client {
+	client := &Client{
+		Router:          gin.Default(),
+		BlockChain:      chain,
+		Scheduler:       cron.New(),
+		TransactionPool: blockchain.NewMempool(false),
+		Peers:           peers,
 	}
 
 	client.Router.GET("/api", client.getBlockChain)
 	client.Router.GET("/api/transactions", client.getTransactions)
 	client.Router.GET("/api/utxo", client.getUTXO)
+	client.Router.GET("/api/utxo/:address", client.getAddressUTXO)
 	client.Router.GET("/api/peers", client.getPeers)
+	client.Router.GET("/api/difficulty", client.getDifficulty)
 	client.Router.POST("/api/transactions", client.postTransaction)
+	client.Router.POST("/api/script/debug", client.postScriptDebug)
 	client.Router.POST("/api", client.postBlock)
 
 	client.Scheduler.AddFunc("@every 1m", client.MineCandidateBlock)
@@ -54,18 +63,30 @@ func (client *Client) Start() {
 }
 
 func (client *Client) MineCandidateBlock() {
-	transactions := client.TransactionPool
+	height := len(client.BlockChain.Chain)
+	reserved := 0
+	if client.MinerScript != "" {
+		reserved = blockchain.TransactionSize(blockchain.NewCoinbaseTransaction(height, 0, client.MinerScript))
+	}
+
+	transactions, fees, _ := client.BlockChain.SelectTransactions(client.TransactionPool.Transactions(), reserved)
 	if len(transactions) < 1 {
 		fmt.Println("No transactions in transaction pool, skipping mining")
 		return
 	} else {
-		fmt.Printf("%d transactions in transaction pool, starting mining...\n", len(transactions))
+		fmt.Printf("%d of %d transactions selected from transaction pool, starting mining...\n", len(transactions), client.TransactionPool.Len())
+	}
+
+	for _, transaction := range transactions {
+		client.TransactionPool.Remove(transaction.TXID)
 	}
 
-	client.TransactionPool = nil
-	prevBlock := client.BlockChain.Chain[len(client.BlockChain.Chain)-1]
+	if client.MinerScript != "" {
+		coinbase := blockchain.NewCoinbaseTransaction(height, client.BlockChain.Subsidy(height)+fees, client.MinerScript)
+		transactions = append([]blockchain.Transaction{coinbase}, transactions...)
+	}
 
-	candidateBlock := blockchain.NewBlock(prevBlock, transactions)
+	candidateBlock := client.BlockChain.NewCandidateBlock(transactions)
 	stopMining := make(chan bool)
 
 	go candidateBlock.Mine(stopMining, func(b blockchain.Block) { client.AddBlockAndPropagate(b) })
@@ -79,7 +100,7 @@ func (client *Client) postTransaction(c *gin.Context) {
 	var newTransaction struct {
 		Inputs   []blockchain.TransactionInput
 		Outputs  []blockchain.TransactionOutput
-		LockTime time.Duration
+		LockTime int64
 	}
 
 	if err := c.BindJSON(&newTransaction); err != nil {
@@ -87,21 +108,75 @@ func (client *Client) postTransaction(c *gin.Context) {
 		return
 	}
 
-	transaction := blockchain.NewTransaction(newTransaction.Inputs, newTransaction.Outputs)
-	if !client.BlockChain.IsValidTransaction(transaction) {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid transaction"})
+	transaction := blockchain.NewLockedTransaction(newTransaction.Inputs, newTransaction.Outputs, newTransaction.LockTime)
+	replaced, err := client.TransactionPool.Add(client.BlockChain, transaction)
+	if err != nil {
+		c.IndentedJSON(http.StatusBadRequest, errorResponse("Invalid transaction", err))
+		return
+	}
+
+	for _, t := range replaced {
+		fmt.Printf("Transaction %s replaced %s in transaction pool\n", transaction.TXID, t.TXID)
+	}
+}
+
+// postScriptDebug traces either a script unlocked by ScriptSig and Args, or
+// the unlocking of input Input of a transaction against the current UTXO set.
+func (client *Client) postScriptDebug(c *gin.Context) {
+	var debug struct {
+		Script    string
+		ScriptSig string
+		Args      map[string]string
+		Inputs    []blockchain.TransactionInput
+		Outputs   []blockchain.TransactionOutput
+		LockTime  int64
+		Input     int
+	}
+
+	if err := c.BindJSON(&debug); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid debug fields"})
 		return
 	}
 
-	client.TransactionPool = append(client.TransactionPool, transaction)
+	var steps []script.TraceStep
+	var err error
+	if len(debug.Inputs) > 0 {
+		if debug.Input < 0 || debug.Input >= len(debug.Inputs) {
+			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("Invalid input index %d", debug.Input)})
+			return
+		}
+		transaction := blockchain.NewLockedTransaction(debug.Inputs, debug.Outputs, debug.LockTime)
+		steps, err = client.BlockChain.TraceUnlock(transaction, debug.Input)
+	} else {
+		steps, err = script.Trace(debug.ScriptSig, debug.Script, script.Context{Args: debug.Args, LockTime: debug.LockTime})
+	}
+
+	res := gin.H{"steps": steps, "valid": err == nil}
+	if err != nil {
+		for key, value := range errorResponse("Script failed", err) {
+			res[key] = value
+		}
+	}
+	c.IndentedJSON(http.StatusOK, res)
 }
 
 func (client *Client) getTransactions(c *gin.Context) {
-	c.IndentedJSON(http.StatusOK, client.TransactionPool)
+	c.IndentedJSON(http.StatusOK, client.TransactionPool.Transactions())
 }
 
 func (client *Client) getUTXO(c *gin.Context) {
-	c.IndentedJSON(http.StatusOK, client.BlockChain.UTXO)
+	c.IndentedJSON(http.StatusOK, client.BlockChain.UTXO.Unspent())
+}
+
+func (client *Client) getDifficulty(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, gin.H{
+		"difficulty":          client.BlockChain.NextDifficulty(),
+		"targetBlockInterval": client.BlockChain.TargetBlockInterval().Seconds(),
+	})
+}
+
+func (client *Client) getAddressUTXO(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, client.BlockChain.UTXO.FindByAddress(c.Param("address")))
 }
 
 func (client *Client) getPeers(c *gin.Context) {
@@ -152,13 +227,19 @@ func (client *Client) SyncBlockchain(peer string) {
 		return
 	}
 
-	if !bc.IsValid() {
-		fmt.Printf("Invalid blockchain received from %s\n", peer)
+	bc.GenesisBlock = client.BlockChain.GenesisBlock
+	if err := bc.Validate(); err != nil {
+		fmt.Printf("Invalid blockchain received from %s: %v\n", peer, err)
 		return
 	}
 
-	if len(bc.Chain) > len(client.BlockChain.Chain) {
-		*client.BlockChain = bc
+	if bc.CumulativeWork().Cmp(client.BlockChain.CumulativeWork()) > 0 {
+		orphaned, err := client.BlockChain.Replace(bc)
+		if err != nil {
+			fmt.Printf("Error persisting chain synced from %s: %v\n", peer, err)
+		}
+		client.TransactionPool.Update(client.BlockChain)
+		client.returnToPool(orphaned)
 		fmt.Printf("Synced chain of length %d with %s\n", len(bc.Chain), peer)
 	}
 }
@@ -170,38 +251,50 @@ func (client *Client) postBlock(c *gin.Context) {
 		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid block fields"})
 		return
 	}
-	fmt.Println(block, block.Hash())
 
-	if block.Header.Height < len(client.BlockChain.Chain) {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Block height is too low"})
+	if err := client.AddBlockAndPropagate(block); err != nil {
+		c.IndentedJSON(http.StatusBadRequest, errorResponse("Invalid block", err))
 		return
 	}
+}
 
-	if !block.IsValid() {
-		c.IndentedJSON(http.StatusBadRequest, gin.H{"message": "Invalid block"})
-		return
+// errorResponse reports why err was rejected, with the failing script
+// instruction when a script did not unlock its output or where it failed to
+// parse.
+func errorResponse(message string, err error) gin.H {
+	res := gin.H{"message": fmt.Sprintf("%s: %v", message, err)}
+
+	var evalErr *script.EvalError
+	if errors.As(err, &evalErr) {
+		res["instruction"] = evalErr.Instruction
+		res["instructionIndex"] = evalErr.Index
+		res["reason"] = evalErr.Err.Error()
 	}
 
-	for idx, transaction := range block.Transactions {
-		if !client.BlockChain.IsValidTransaction(transaction) {
-			c.IndentedJSON(http.StatusBadRequest, gin.H{"message": fmt.Sprintf("Invalid transaction with index %d", idx)})
-			return
-		}
+	var parseErr *script.ParseError
+	if errors.As(err, &parseErr) {
+		res["position"] = parseErr.Pos.String()
+		res["reason"] = parseErr.Err.Error()
 	}
 
-	client.AddBlockAndPropagate(block)
+	return res
 }
 
-func (client *Client) AddBlockAndPropagate(block blockchain.Block) {
+func (client *Client) AddBlockAndPropagate(block blockchain.Block) error {
 	reqBody, err := json.Marshal(block)
 	if err != nil {
-		return
+		return err
 	}
 
-	ok := client.BlockChain.AddBlock(block)
-	if ok {
-		fmt.Printf("Added block with hash %x\n", block.Hash())
+	orphaned, err := client.BlockChain.ProcessBlock(block)
+	if err != nil {
+		fmt.Printf("Rejected block with hash %x: %v\n", block.Hash(), err)
+		return err
 	}
+	fmt.Printf("Added block with hash %x\n", block.Hash())
+
+	client.TransactionPool.Update(client.BlockChain)
+	client.returnToPool(orphaned)
 
 	for _, peer := range client.Peers {
 		resp, err := http.Post(fmt.Sprintf("%s/api", peer), "application/json", bytes.NewBuffer(reqBody))
@@ -211,4 +304,20 @@ func (client *Client) AddBlockAndPropagate(block blockchain.Block) {
 			fmt.Printf("%s refused block\n", peer)
 		}
 	}
+
+	return nil
+}
+
+func (client *Client) returnToPool(transactions []blockchain.Transaction) {
+	returned := 0
+
+	for _, transaction := range transactions {
+		if _, err := client.TransactionPool.Add(client.BlockChain, transaction); err == nil {
+			returned++
+		}
+	}
+
+	if len(transactions) > 0 {
+		fmt.Printf("Returned %d of %d orphaned transactions to the transaction pool\n", returned, len(transactions))
+	}
 }
@@ -0,0 +1,92 @@
+package client
+
+import (
+	"errors"
+	"fmt"
+	"github.com/gin-gonic/gin"
+	"net/http"
+	"oracle"
+)
+
+type attestationResponse struct {
+	ID string
+	oracle.Attestation
+	ScriptArgs map[string]string
+}
+
+func newAttestationResponse(a oracle.Attestation) attestationResponse {
+	return attestationResponse{ID: a.ID(), Attestation: a, ScriptArgs: a.ScriptArgs()}
+}
+
+// EnableOracle makes the client attest the observations of source with o,
+// every minute, and serve the attestations under /api/oracle. source may be
+// nil to only serve the attestations already in o.Store.
+func (client *Client) EnableOracle(o *oracle.Oracle, source oracle.Source) {
+	client.Oracle = o
+	client.OracleSource = source
+
+	client.Router.GET("/api/oracle", client.getOracle)
+	client.Router.GET("/api/oracle/attestations", client.getAttestations)
+	client.Router.GET("/api/oracle/attestations/:id", client.getAttestation)
+
+	client.IngestObservations()
+	client.Scheduler.AddFunc("@every 1m", client.IngestObservations)
+}
+
+func (client *Client) IngestObservations() {
+	if client.OracleSource == nil {
+		return
+	}
+
+	attested, err := client.Oracle.Ingest(client.OracleSource)
+	if err != nil {
+		fmt.Printf("Could not ingest observations: %v\n", err)
+	}
+	if len(attested) > 0 {
+		fmt.Printf("Attested %d new observations\n", len(attested))
+	}
+}
+
+func (client *Client) getOracle(c *gin.Context) {
+	c.IndentedJSON(http.StatusOK, gin.H{"pubKey": client.Oracle.PublicKey()})
+}
+
+// getAttestations lists the attestations, filtered by the station, field and
+// timestamp query parameters when given.
+func (client *Client) getAttestations(c *gin.Context) {
+	attestations, err := client.Oracle.Store.List()
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	res := []attestationResponse{}
+	for _, a := range attestations {
+		if station := c.Query("station"); station != "" && station != a.Station {
+			continue
+		}
+		if field := c.Query("field"); field != "" && field != a.Field {
+			continue
+		}
+		if timestamp := c.Query("timestamp"); timestamp != "" && timestamp != fmt.Sprint(a.Timestamp) {
+			continue
+		}
+		res = append(res, newAttestationResponse(a))
+	}
+
+	c.IndentedJSON(http.StatusOK, res)
+}
+
+func (client *Client) getAttestation(c *gin.Context) {
+	a, err := client.Oracle.Store.Get(c.Param("id"))
+	if errors.Is(err, oracle.ErrNotFound) {
+		c.IndentedJSON(http.StatusNotFound, gin.H{"message": "Attestation not found"})
+		return
+	}
+	if err != nil {
+		c.IndentedJSON(http.StatusInternalServerError, gin.H{"message": err.Error()})
+		return
+	}
+
+	c.IndentedJSON(http.StatusOK, newAttestationResponse(a))
+}
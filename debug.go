@@ -0,0 +1,104 @@
+package main
+
+import (
+	"blockchain"
+	"encoding/json"
+	"errors"
+	"flag"
+	"fmt"
+	"os"
+	"script"
+	"strings"
+)
+
+type argsFlag map[string]string
+
+func (a argsFlag) String() string {
+	return fmt.Sprint(map[string]string(a))
+}
+
+func (a argsFlag) Set(value string) error {
+	name, arg, ok := strings.Cut(value, "=")
+	if !ok {
+		return fmt.Errorf("expected name=value, got %q", value)
+	}
+	a[name] = arg
+	return nil
+}
+
+// debug traces a script given on the command line, or the unlocking of an
+// input of a transaction read from a JSON file against the local chain.
+func debug(arguments []string) error {
+	flags := flag.NewFlagSet("debug", flag.ExitOnError)
+	dataDir := flags.String("data", "chaindata", "directory where blocks and the UTXO set are stored")
+	txFile := flags.String("tx", "", "JSON transaction whose input to trace against the chain")
+	input := flags.Int("input", 0, "index of the input of -tx to trace")
+	scriptSig := flags.String("sig", "", "unlocking script pushed before the script runs")
+	lockTime := flags.Int64("locktime", 0, "lock time of the spending transaction when tracing a script")
+	args := argsFlag{}
+	flags.Var(args, "arg", "script argument as name=value, may be repeated")
+	flags.Usage = func() {
+		fmt.Fprintln(flags.Output(), "Usage: weatherbet debug [flags] [--] [script]")
+		flags.PrintDefaults()
+	}
+	flags.Parse(arguments)
+
+	var steps []script.TraceStep
+	var err error
+	if *txFile != "" {
+		transaction, readErr := readTransaction(*txFile, *input)
+		if readErr != nil {
+			return readErr
+		}
+
+		store, openErr := blockchain.OpenFileStoreReadOnly(*dataDir)
+		if openErr != nil {
+			return openErr
+		}
+		defer store.Close()
+
+		chain, loadErr := blockchain.ReadChain(genesisBlock(), store)
+		if loadErr != nil {
+			return loadErr
+		}
+		steps, err = chain.TraceUnlock(transaction, *input)
+	} else {
+		steps, err = script.Trace(*scriptSig, strings.Join(flags.Args(), " "), script.Context{Args: args, LockTime: *lockTime})
+	}
+
+	for _, step := range steps {
+		state := fmt.Sprintf("[%s]", strings.Join(step.Stack, " "))
+		if !step.Executed {
+			state = "(skipped)"
+		}
+		fmt.Printf("%4d  %-8s %-24s %s\n", step.Index, step.Position, step.Instruction, state)
+	}
+
+	var evalErr *script.EvalError
+	if errors.As(err, &evalErr) {
+		return fmt.Errorf("failed at instruction %d (%s): %w", evalErr.Index, evalErr.Instruction, evalErr.Err)
+	}
+	if err != nil {
+		return fmt.Errorf("failed: %w", err)
+	}
+
+	fmt.Println("Unlocked")
+	return nil
+}
+
+func readTransaction(txFile string, input int) (blockchain.Transaction, error) {
+	var transaction blockchain.Transaction
+
+	data, err := os.ReadFile(txFile)
+	if err != nil {
+		return transaction, err
+	}
+	if err := json.Unmarshal(data, &transaction); err != nil {
+		return transaction, fmt.Errorf("%s: %w", txFile, err)
+	}
+	if input < 0 || input >= len(transaction.Inputs) {
+		return transaction, fmt.Errorf("transaction has no input %d", input)
+	}
+
+	return transaction, nil
+}
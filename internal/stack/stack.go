@@ -1,6 +1,8 @@
 package stack
 
-import "fmt"
+import "errors"
+
+var ErrEmpty = errors.New("stack is empty")
 
 type Stack struct {
 	items []string
@@ -14,18 +16,18 @@ func (s *Stack) Push(data string, items ...string) {
 	}
 }
 
-func (s *Stack) Pop() string {
+func (s *Stack) Pop() (string, error) {
 	if s.IsEmpty() {
-		return ""
+		return "", ErrEmpty
 	}
 	res := s.items[len(s.items)-1]
 	s.items = s.items[:len(s.items)-1]
-	return res
+	return res, nil
 }
 
 func (s *Stack) Top() (string, error) {
 	if s.IsEmpty() {
-		return "", fmt.Errorf("stack is empty")
+		return "", ErrEmpty
 	}
 	return s.items[len(s.items)-1], nil
 }
@@ -36,3 +38,12 @@ func (s *Stack) IsEmpty() bool {
 	}
 	return false
 }
+
+func (s *Stack) Len() int {
+	return len(s.items)
+}
+
+// Items returns a copy of the stack from bottom to top.
+func (s *Stack) Items() []string {
+	return append([]string{}, s.items...)
+}
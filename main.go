@@ -3,30 +3,72 @@ package main
 import (
 	"blockchain"
 	"client"
+	"flag"
+	"log"
+	"oracle"
 	"os"
 )
 
-func main() {
-	genesis := blockchain.Block{
-		Transactions: []blockchain.Transaction{
+func genesisBlock() blockchain.Block {
+	return blockchain.NewGenesisBlock(
+		[]blockchain.Transaction{
 			blockchain.NewTransaction(
 				[]blockchain.TransactionInput{},
 				[]blockchain.TransactionOutput{
 					{
 						Value:  200,
-						Script: "sign pubKey --- pubKey OPDup OPHash 3e4c25fe2d8751520c0b444d3e43a955feb782f10b25c68acebfe8c29dc63c91 OPEqualVerify sign OPDup pubKey OPDup OPHash pubKey OPDup OPCheckSig",
+						Script: "sign pubKey --- pubKey OPDup OPHash 3e4c25fe2d8751520c0b444d3e43a955feb782f10b25c68acebfe8c29dc63c91 OPEqualVerify sign OPDup pubKey OPDup OPCheckSig",
 					},
 				},
 			),
 		},
+	)
+}
+
+func main() {
+	if len(os.Args) > 1 && os.Args[1] == "debug" {
+		if err := debug(os.Args[2:]); err != nil {
+			log.Fatal(err)
+		}
+		return
 	}
-	chain := blockchain.NewChain(genesis)
-	var peers []string
 
-	if len(os.Args) > 1 {
-		peers = append(peers, os.Args[1:]...)
+	genesis := genesisBlock()
+	dataDir := flag.String("data", "chaindata", "directory where blocks and the UTXO set are stored")
+	minerScript := flag.String("miner-script", "", "locking script paid the block reward of mined blocks")
+	replaceByFee := flag.Bool("rbf", false, "let conflicting transactions paying a higher fee replace pooled ones")
+	oracleDir := flag.String("oracle-dir", "", "run a weather oracle keeping its key and attestations in this directory")
+	oracleFeed := flag.String("oracle-feed", "", "JSON or CSV file of weather observations for the oracle to attest")
+	flag.Parse()
+
+	store, err := blockchain.OpenFileStore(*dataDir)
+	if err != nil {
+		log.Fatal(err)
 	}
+	defer store.Close()
+
+	chain, err := blockchain.LoadChain(genesis, store)
+	if err != nil {
+		log.Fatal(err)
+	}
+	peers := flag.Args()
 
 	blockClient := client.NewClient(&chain, peers)
+	blockClient.MinerScript = *minerScript
+	blockClient.TransactionPool.ReplaceByFee = *replaceByFee
+
+	if *oracleDir != "" {
+		weatherOracle, err := oracle.OpenFileOracle(*oracleDir)
+		if err != nil {
+			log.Fatal(err)
+		}
+
+		var source oracle.Source
+		if *oracleFeed != "" {
+			source = oracle.FileSource{Path: *oracleFeed}
+		}
+		blockClient.EnableOracle(weatherOracle, source)
+	}
+
 	blockClient.Start()
 }
@@ -0,0 +1,117 @@
+package oracle
+
+import (
+	"bytes"
+	"crypto/ed25519"
+	"crypto/sha256"
+	"encoding/binary"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+)
+
+var (
+	ErrBadKey             = errors.New("bad oracle public key")
+	ErrBadSignature       = errors.New("bad oracle signature")
+	ErrNotFound           = errors.New("attestation not found")
+	ErrInvalidObservation = errors.New("invalid observation")
+	ErrConflictingValue   = errors.New("observation already attested with another value")
+)
+
+// messagePrefix keeps oracle signatures from being valid for anything else
+// signed with the same key.
+const messagePrefix = "weatherbet oracle attestation v2"
+
+// Observation is one weather measurement, e.g. the "temperature" field of a
+// station at a unix timestamp.
+type Observation struct {
+	Station   string
+	Field     string
+	Value     string
+	Timestamp int64
+}
+
+// Attestation is an Observation signed by an oracle. Keys and signatures are
+// hex encoded so they can be written as script tokens.
+type Attestation struct {
+	Observation
+	PubKey    string
+	Signature string
+}
+
+// Validate checks that the observation can be written in a script, where
+// tokens are separated by whitespace and opcodes start with "OP".
+func (o Observation) Validate() error {
+	for name, s := range map[string]string{"station": o.Station, "field": o.Field, "value": o.Value} {
+		if s == "" || strings.ContainsFunc(s, unicode.IsSpace) || strings.HasPrefix(s, "OP") {
+			return fmt.Errorf("%w: %s %q", ErrInvalidObservation, name, s)
+		}
+	}
+
+	return nil
+}
+
+// Message is what the oracle signs: the ID of the attestation and its value.
+func Message(id, value string) []byte {
+	var buf bytes.Buffer
+
+	buf.WriteString(messagePrefix)
+	for _, s := range []string{id, value} {
+		binary.Write(&buf, binary.BigEndian, uint32(len(s)))
+		buf.WriteString(s)
+	}
+
+	return buf.Bytes()
+}
+
+// ObservationID identifies what the oracle with pubKey attests for station
+// and field at timestamp, but not the value: an oracle attests a single
+// value for each, so scripts can reference the attestation before it exists.
+func ObservationID(pubKey, station, field string, timestamp int64) string {
+	var buf bytes.Buffer
+
+	for _, s := range []string{pubKey, station, field} {
+		binary.Write(&buf, binary.BigEndian, uint32(len(s)))
+		buf.WriteString(s)
+	}
+	binary.Write(&buf, binary.BigEndian, timestamp)
+
+	hash := sha256.Sum256(buf.Bytes())
+	return hex.EncodeToString(hash[:])
+}
+
+func (a Attestation) ID() string {
+	return ObservationID(a.PubKey, a.Station, a.Field, a.Timestamp)
+}
+
+// Condition is the script fragment checking the attestation with id of the
+// oracle with pubKey. It expects the value and signature in the "value" and
+// "sig" script arguments, see ScriptArgs, and leaves the attested value on
+// the stack.
+func Condition(pubKey, id string) string {
+	return fmt.Sprintf("sig OPDup value OPDup %s %s OPCheckThirdParty", pubKey, id)
+}
+
+func (a Attestation) ScriptArgs() map[string]string {
+	return map[string]string{"sig": a.Signature, "value": a.Value}
+}
+
+func (a Attestation) Verify() error {
+	return Verify(a.PubKey, a.ID(), a.Value, a.Signature)
+}
+
+func Verify(pubKey, id, value, signature string) error {
+	key, err := hex.DecodeString(pubKey)
+	if err != nil || len(key) != ed25519.PublicKeySize {
+		return fmt.Errorf("%w: %q", ErrBadKey, pubKey)
+	}
+
+	sig, err := hex.DecodeString(signature)
+	if err != nil || !ed25519.Verify(key, Message(id, value), sig) {
+		return fmt.Errorf("%w: %s for attestation %s", ErrBadSignature, value, id)
+	}
+
+	return nil
+}
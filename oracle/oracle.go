@@ -0,0 +1,129 @@
+package oracle
+
+import (
+	"crypto/ed25519"
+	"crypto/rand"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+)
+
+const keyFile = "oracle.key"
+
+// Oracle signs observations with its key and keeps the attestations it made
+// in Store so they can be handed to the spenders of weather bets.
+type Oracle struct {
+	mu    sync.Mutex
+	key   ed25519.PrivateKey
+	Store Store
+}
+
+func New(key ed25519.PrivateKey, store Store) *Oracle {
+	return &Oracle{key: key, Store: store}
+}
+
+// OpenFileOracle loads the oracle key and attestations kept in dir, creating
+// a new key on first use. It stands in for a real weather oracle.
+func OpenFileOracle(dir string) (*Oracle, error) {
+	if err := os.MkdirAll(dir, 0o755); err != nil {
+		return nil, err
+	}
+
+	key, err := loadKey(filepath.Join(dir, keyFile))
+	if err != nil {
+		return nil, err
+	}
+
+	store, err := OpenFileStore(dir)
+	if err != nil {
+		return nil, err
+	}
+
+	return New(key, store), nil
+}
+
+func loadKey(path string) (ed25519.PrivateKey, error) {
+	data, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		_, key, err := ed25519.GenerateKey(rand.Reader)
+		if err != nil {
+			return nil, err
+		}
+		seed := hex.EncodeToString(key.Seed())
+		return key, os.WriteFile(path, []byte(seed+"\n"), 0o600)
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	seed, err := hex.DecodeString(strings.TrimSpace(string(data)))
+	if err != nil || len(seed) != ed25519.SeedSize {
+		return nil, fmt.Errorf("invalid oracle key in %s", path)
+	}
+
+	return ed25519.NewKeyFromSeed(seed), nil
+}
+
+func (o *Oracle) PublicKey() string {
+	return hex.EncodeToString(o.key.Public().(ed25519.PublicKey))
+}
+
+// Attest signs observation, or returns the attestation already made for the
+// same station, field and timestamp. It refuses to sign another value for
+// them, which would let either side of a bet settle it.
+func (o *Oracle) Attest(observation Observation) (Attestation, error) {
+	if err := observation.Validate(); err != nil {
+		return Attestation{}, err
+	}
+
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	attestation := Attestation{Observation: observation, PubKey: o.PublicKey()}
+	if existing, err := o.Store.Get(attestation.ID()); err == nil {
+		if existing.Value != observation.Value {
+			return Attestation{}, fmt.Errorf("%w: %s %s at %d is %s, not %s", ErrConflictingValue, observation.Station, observation.Field, observation.Timestamp, existing.Value, observation.Value)
+		}
+		return existing, nil
+	}
+
+	attestation.Signature = hex.EncodeToString(ed25519.Sign(o.key, Message(attestation.ID(), observation.Value)))
+	if err := o.Store.Put(attestation); err != nil {
+		return Attestation{}, err
+	}
+
+	return attestation, nil
+}
+
+// Ingest attests the observations of source that were not attested yet and
+// returns the new attestations. Observations contradicting an earlier
+// attestation are skipped.
+func (o *Oracle) Ingest(source Source) ([]Attestation, error) {
+	observations, err := source.Observations()
+	if err != nil {
+		return nil, err
+	}
+
+	var attested []Attestation
+	for _, observation := range observations {
+		id := Attestation{Observation: observation, PubKey: o.PublicKey()}.ID()
+		if existing, err := o.Store.Get(id); err == nil {
+			if existing.Value != observation.Value {
+				fmt.Printf("Refusing to attest %s %s at %d as %s, already attested as %s\n", observation.Station, observation.Field, observation.Timestamp, observation.Value, existing.Value)
+			}
+			continue
+		}
+
+		attestation, err := o.Attest(observation)
+		if err != nil {
+			return attested, err
+		}
+		attested = append(attested, attestation)
+	}
+
+	return attested, nil
+}
@@ -0,0 +1,108 @@
+package oracle_test
+
+import (
+	"errors"
+	"oracle"
+	"script"
+	"testing"
+)
+
+var observation = oracle.Observation{Station: "LFPG", Field: "temperature", Value: "21", Timestamp: 1700000000}
+
+func TestAttestationVerify(t *testing.T) {
+	o, err := oracle.OpenFileOracle(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attestation, err := o.Attest(observation)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := attestation.Verify(); err != nil {
+		t.Fatalf("Got %v, expected a valid attestation", err)
+	}
+
+	tampered := attestation
+	tampered.Value = "35"
+	if err := tampered.Verify(); !errors.Is(err, oracle.ErrBadSignature) {
+		t.Fatalf("Got %v, expected ErrBadSignature", err)
+	}
+
+	tampered = attestation
+	tampered.PubKey = "not hex"
+	if err := tampered.Verify(); !errors.Is(err, oracle.ErrBadKey) {
+		t.Fatalf("Got %v, expected ErrBadKey", err)
+	}
+}
+
+func TestFileOracleReopen(t *testing.T) {
+	dir := t.TempDir()
+
+	o, err := oracle.OpenFileOracle(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	attestation, err := o.Attest(observation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reopened, err := oracle.OpenFileOracle(dir)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if reopened.PublicKey() != o.PublicKey() {
+		t.Fatalf("Got key %s, expected %s", reopened.PublicKey(), o.PublicKey())
+	}
+
+	stored, err := reopened.Store.Get(attestation.ID())
+	if err != nil || stored != attestation {
+		t.Fatalf("Store.Get() == %v, %v, expected %v", stored, err, attestation)
+	}
+	if _, err := reopened.Store.Get("unknown"); !errors.Is(err, oracle.ErrNotFound) {
+		t.Fatalf("Got %v, expected ErrNotFound", err)
+	}
+}
+
+func TestStoreRejectsForgedAttestation(t *testing.T) {
+	o, err := oracle.OpenFileOracle(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	attestation, err := o.Attest(observation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	attestation.Timestamp++
+	if err := oracle.NewMemoryStore().Put(attestation); !errors.Is(err, oracle.ErrBadSignature) {
+		t.Fatalf("Got %v, expected ErrBadSignature", err)
+	}
+}
+
+func TestConditionUnlockedByScriptArgs(t *testing.T) {
+	o, err := oracle.OpenFileOracle(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	attestation, err := o.Attest(observation)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := "sig value --- " + oracle.Condition(o.PublicKey(), attestation.ID()) + " 21 OPEqual"
+	if err := script.EvalScript(s, script.Context{Args: attestation.ScriptArgs()}); err != nil {
+		t.Fatalf("Got %v, expected the attestation to satisfy the condition", err)
+	}
+}
+
+func TestObservationValidateWhitespace(t *testing.T) {
+	for _, station := range []string{"St Malo", "LF\vPG", "LF\fPG", "LF\u00a0PG"} {
+		invalid := observation
+		invalid.Station = station
+		if err := invalid.Validate(); !errors.Is(err, oracle.ErrInvalidObservation) {
+			t.Fatalf("Validate(%q) == %v, expected ErrInvalidObservation", station, err)
+		}
+	}
+}
@@ -0,0 +1,77 @@
+package oracle
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+)
+
+// Source yields the observations an Oracle attests to.
+type Source interface {
+	Observations() ([]Observation, error)
+}
+
+// FileSource reads observations from a local feed, either a CSV file with a
+// station,field,value,timestamp header or a JSON array of observations.
+type FileSource struct {
+	Path string
+}
+
+func (s FileSource) Observations() ([]Observation, error) {
+	f, err := os.Open(s.Path)
+	if err != nil {
+		return nil, err
+	}
+	defer f.Close()
+
+	if strings.EqualFold(filepath.Ext(s.Path), ".csv") {
+		return readCSV(csv.NewReader(f))
+	}
+
+	var observations []Observation
+	if err := json.NewDecoder(f).Decode(&observations); err != nil {
+		return nil, fmt.Errorf("%s: %w", s.Path, err)
+	}
+	return observations, nil
+}
+
+func readCSV(r *csv.Reader) ([]Observation, error) {
+	records, err := r.ReadAll()
+	if err != nil {
+		return nil, err
+	}
+	if len(records) == 0 {
+		return nil, nil
+	}
+
+	columns := make(map[string]int)
+	for idx, name := range records[0] {
+		columns[strings.ToLower(strings.TrimSpace(name))] = idx
+	}
+	for _, name := range []string{"station", "field", "value", "timestamp"} {
+		if _, ok := columns[name]; !ok {
+			return nil, fmt.Errorf("missing %s column", name)
+		}
+	}
+
+	var observations []Observation
+	for line, record := range records[1:] {
+		timestamp, err := strconv.ParseInt(record[columns["timestamp"]], 10, 64)
+		if err != nil {
+			return nil, fmt.Errorf("line %d: invalid timestamp: %w", line+2, err)
+		}
+
+		observations = append(observations, Observation{
+			Station:   record[columns["station"]],
+			Field:     record[columns["field"]],
+			Value:     record[columns["value"]],
+			Timestamp: timestamp,
+		})
+	}
+
+	return observations, nil
+}
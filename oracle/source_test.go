@@ -0,0 +1,95 @@
+package oracle_test
+
+import (
+	"errors"
+	"oracle"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestFileSource(t *testing.T) {
+	tests := map[string]int{
+		"testdata/observations.csv":  3,
+		"testdata/observations.json": 2,
+	}
+
+	for path, expected := range tests {
+		observations, err := oracle.FileSource{Path: path}.Observations()
+		if err != nil {
+			t.Fatalf("%s: %v", path, err)
+		}
+		if len(observations) != expected {
+			t.Fatalf("%s: got %d observations, expected %d", path, len(observations), expected)
+		}
+	}
+
+	observations, _ := oracle.FileSource{Path: "testdata/observations.csv"}.Observations()
+	if observations[0] != observation {
+		t.Fatalf("Got %v, expected %v", observations[0], observation)
+	}
+}
+
+func TestIngestOnlyAttestsNewObservations(t *testing.T) {
+	o, err := oracle.OpenFileOracle(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	source := oracle.FileSource{Path: "testdata/observations.csv"}
+
+	attested, err := o.Ingest(source)
+	if err != nil || len(attested) != 3 {
+		t.Fatalf("Ingest() == %v, %v, expected 3 attestations", attested, err)
+	}
+
+	attested, err = o.Ingest(source)
+	if err != nil || len(attested) != 0 {
+		t.Fatalf("Ingest() == %v, %v, expected nothing new", attested, err)
+	}
+}
+
+func TestIngestRefusesConflictingValue(t *testing.T) {
+	o, err := oracle.OpenFileOracle(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Ingest(oracle.FileSource{Path: "testdata/observations.csv"}); err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "feed.csv")
+	if err := os.WriteFile(path, []byte("station,field,value,timestamp\nLFPG,temperature,35,1700000000\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+	attested, err := o.Ingest(oracle.FileSource{Path: path})
+	if err != nil || len(attested) != 0 {
+		t.Fatalf("Ingest() == %v, %v, expected the corrected value to be refused", attested, err)
+	}
+
+	corrected := oracle.Observation{Station: "LFPG", Field: "temperature", Value: "35", Timestamp: 1700000000}
+	if _, err := o.Attest(corrected); !errors.Is(err, oracle.ErrConflictingValue) {
+		t.Fatalf("Got %v, expected ErrConflictingValue", err)
+	}
+
+	attestations, _ := o.Store.List()
+	for _, a := range attestations {
+		if a.Station == "LFPG" && a.Field == "temperature" && a.Value != "21" {
+			t.Fatalf("Got attestation of %s, expected only 21", a.Value)
+		}
+	}
+}
+
+func TestIngestRejectsInvalidObservation(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "feed.csv")
+	if err := os.WriteFile(path, []byte("station,field,value,timestamp\nSt Malo,temperature,18,1700000000\n"), 0o644); err != nil {
+		t.Fatal(err)
+	}
+
+	o, err := oracle.OpenFileOracle(t.TempDir())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, err := o.Ingest(oracle.FileSource{Path: path}); !errors.Is(err, oracle.ErrInvalidObservation) {
+		t.Fatalf("Got %v, expected ErrInvalidObservation", err)
+	}
+}
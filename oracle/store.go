@@ -0,0 +1,120 @@
+package oracle
+
+import (
+	"encoding/json"
+	"errors"
+	"os"
+	"path/filepath"
+	"sort"
+	"sync"
+)
+
+const attestationsFile = "attestations.json"
+
+type Store interface {
+	Put(Attestation) error
+	Get(id string) (Attestation, error)
+	List() ([]Attestation, error)
+}
+
+type MemoryStore struct {
+	mu           sync.Mutex
+	attestations map[string]Attestation
+}
+
+func NewMemoryStore() *MemoryStore {
+	return &MemoryStore{attestations: make(map[string]Attestation)}
+}
+
+func (s *MemoryStore) Put(a Attestation) error {
+	if err := a.Verify(); err != nil {
+		return err
+	}
+
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.attestations[a.ID()] = a
+	return nil
+}
+
+func (s *MemoryStore) Get(id string) (Attestation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	a, ok := s.attestations[id]
+	if !ok {
+		return Attestation{}, ErrNotFound
+	}
+	return a, nil
+}
+
+// List returns the attestations ordered by timestamp, then ID.
+func (s *MemoryStore) List() ([]Attestation, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	res := make([]Attestation, 0, len(s.attestations))
+	for _, a := range s.attestations {
+		res = append(res, a)
+	}
+	sort.Slice(res, func(i, j int) bool {
+		if res[i].Timestamp != res[j].Timestamp {
+			return res[i].Timestamp < res[j].Timestamp
+		}
+		return res[i].ID() < res[j].ID()
+	})
+
+	return res, nil
+}
+
+// FileStore is a MemoryStore written to dir/attestations.json on every Put.
+type FileStore struct {
+	*MemoryStore
+	path string
+	mu   sync.Mutex
+}
+
+func OpenFileStore(dir string) (*FileStore, error) {
+	s := &FileStore{MemoryStore: NewMemoryStore(), path: filepath.Join(dir, attestationsFile)}
+
+	data, err := os.ReadFile(s.path)
+	if errors.Is(err, os.ErrNotExist) {
+		return s, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var attestations []Attestation
+	if err := json.Unmarshal(data, &attestations); err != nil {
+		return nil, err
+	}
+	for _, a := range attestations {
+		if err := s.MemoryStore.Put(a); err != nil {
+			return nil, err
+		}
+	}
+
+	return s, nil
+}
+
+func (s *FileStore) Put(a Attestation) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if err := s.MemoryStore.Put(a); err != nil {
+		return err
+	}
+
+	attestations, _ := s.List()
+	data, err := json.MarshalIndent(attestations, "", "  ")
+	if err != nil {
+		return err
+	}
+
+	tmp := s.path + ".tmp"
+	if err := os.WriteFile(tmp, data, 0o644); err != nil {
+		return err
+	}
+	return os.Rename(tmp, s.path)
+}
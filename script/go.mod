@@ -3,10 +3,12 @@ module script
 go 1.21.4
 
 require (
-	github.com/tidwall/gjson v1.17.0 // indirect
-	github.com/tidwall/match v1.1.1 // indirect
-	github.com/tidwall/pretty v1.2.0 // indirect
+  github.com/decred/dcrd/dcrec/secp256k1/v4 v4.2.0
+  golang.org/x/crypto v0.9.0
+  golang.org/x/sys v0.8.0 // indirect
   internal/stack v0.0.0
+  oracle v0.0.0
 )
 
 replace internal/stack => ../internal/stack/
+replace oracle => ../oracle/
@@ -0,0 +1,57 @@
+package script
+
+import (
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+
+	"golang.org/x/crypto/ripemd160"
+	"golang.org/x/crypto/sha3"
+)
+
+// Like OPHash, the hash opcodes hash the bytes of their input and push the
+// hex encoded digest. OPSha256d and OPHash160 chain over the raw digest of
+// the first hash, as Bitcoin does.
+
+func OPSha256d(input string) string {
+	first := sha256.Sum256([]byte(input))
+	hash := sha256.Sum256(first[:])
+	return hex.EncodeToString(hash[:])
+}
+
+func OPRipemd160(input string) string {
+	return hex.EncodeToString(ripemd160Sum([]byte(input)))
+}
+
+func OPHash160(input string) string {
+	first := sha256.Sum256([]byte(input))
+	return hex.EncodeToString(ripemd160Sum(first[:]))
+}
+
+func OPHash3(input string) string {
+	hash := sha3.Sum256([]byte(input))
+	return hex.EncodeToString(hash[:])
+}
+
+func ripemd160Sum(data []byte) []byte {
+	h := ripemd160.New()
+	h.Write(data)
+	return h.Sum(nil)
+}
+
+// NewPreimage returns a random secret for a hash lock and its OPHash160.
+func NewPreimage() (preimage string, hash string, err error) {
+	secret := make([]byte, 32)
+	if _, err := rand.Read(secret); err != nil {
+		return "", "", err
+	}
+
+	preimage = hex.EncodeToString(secret)
+	return preimage, OPHash160(preimage), nil
+}
+
+// HashLock is a script fragment consuming the element on top of the stack
+// and failing unless it is a preimage of hash, see NewPreimage.
+func HashLock(hash string) string {
+	return "OPHash160 " + hash + " OPEqualVerify"
+}
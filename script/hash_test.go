@@ -0,0 +1,54 @@
+package script_test
+
+import (
+	"errors"
+	"script"
+	"testing"
+)
+
+func TestHashOpcodes(t *testing.T) {
+	tests := []struct {
+		opcode string
+		hash   func(string) string
+		input  string
+		digest string
+	}{
+		{"OPHash", script.OPHash, "abc", "ba7816bf8f01cfea414140de5dae2223b00361a396177a9cb410ff61f20015ad"},
+		{"OPSha256d", script.OPSha256d, "abc", "4f8b42c22dd3729b519ba6f68d2da7cc5b2d606d05daed5ad5128cc03e6c6358"},
+		{"OPRipemd160", script.OPRipemd160, "abc", "8eb208f7e05d987a9b044a8e98c6b087f15a0bfc"},
+		{"OPRipemd160", script.OPRipemd160, "abcdefghijklmnopqrstuvwxyz", "f71c27109c692c1b56bbdceb5b9d2865b3708dbc"},
+		{"OPHash160", script.OPHash160, "abc", "bb1be98c142444d7a56aa3981c3942a978e4dc33"},
+		{"OPHash3", script.OPHash3, "abc", "3a985da74fe225b2045c172d6bd390bd855f086e3e9d525b46bfe24511431532"},
+	}
+
+	for _, test := range tests {
+		if digest := test.hash(test.input); digest != test.digest {
+			t.Fatalf("%s(%q) == %s, expected %s", test.opcode, test.input, digest, test.digest)
+		}
+
+		s := "--- " + test.input + " " + test.opcode + " " + test.digest + " OPEqual"
+		if err := script.EvalScript(s, script.Context{}); err != nil {
+			t.Fatalf("EvalScript(%q) == %v", s, err)
+		}
+	}
+
+	if err := script.EvalScript("--- OPHash3", script.Context{}); !errors.Is(err, script.ErrStackUnderflow) {
+		t.Fatalf("Got %v, expected ErrStackUnderflow", err)
+	}
+}
+
+func TestHashLock(t *testing.T) {
+	preimage, hash, err := script.NewPreimage()
+	if err != nil {
+		t.Fatal(err)
+	}
+	other, _, _ := script.NewPreimage()
+
+	lock := "--- " + script.HashLock(hash) + " 1"
+	if err := script.VerifyScript(preimage, lock, script.Context{}); err != nil {
+		t.Fatalf("Got %v, expected the preimage to open the hash lock", err)
+	}
+	if err := script.VerifyScript(other, lock, script.Context{}); !errors.Is(err, script.ErrVerifyFailed) {
+		t.Fatalf("Got %v, expected ErrVerifyFailed", err)
+	}
+}
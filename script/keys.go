@@ -0,0 +1,130 @@
+package script
+
+import (
+	"bytes"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"crypto/x509"
+	"encoding/asn1"
+	"encoding/base64"
+	"encoding/hex"
+	"encoding/pem"
+	"errors"
+	"fmt"
+	"math/big"
+	"strings"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secpecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+// Public keys are written "scheme:hex", with ECDSA keys as compressed points.
+// Untagged keys are base64 encoded PEM RSA keys, as before schemes existed.
+const (
+	SchemeRSA       = "rsa"
+	SchemeEd25519   = "ed25519"
+	SchemeP256      = "p256"
+	SchemeSecp256k1 = "secp256k1"
+)
+
+var ErrUnknownScheme = errors.New("unknown signature scheme")
+
+// EncodePublicKey tags key with its scheme. RSA keys are PKIX DER bytes.
+func EncodePublicKey(scheme string, key []byte) string {
+	if scheme == SchemeRSA {
+		return base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: key}))
+	}
+	return scheme + ":" + hex.EncodeToString(key)
+}
+
+// ParsePublicKey splits a public key into its scheme and raw key bytes.
+func ParsePublicKey(pubKey string) (string, []byte, error) {
+	scheme, encoded, tagged := strings.Cut(pubKey, ":")
+	if !tagged {
+		pDec, err := base64.StdEncoding.DecodeString(pubKey)
+		if err != nil {
+			return "", nil, fmt.Errorf("%w: public key: %v", ErrBadEncoding, err)
+		}
+		pemKey, _ := pem.Decode(pDec)
+		if pemKey == nil {
+			return "", nil, fmt.Errorf("%w: public key is not PEM", ErrBadEncoding)
+		}
+		return SchemeRSA, pemKey.Bytes, nil
+	}
+
+	key, err := hex.DecodeString(encoded)
+	if err != nil {
+		return "", nil, fmt.Errorf("%w: public key: %v", ErrBadEncoding, err)
+	}
+	return scheme, key, nil
+}
+
+// verifySignature checks signature over digest with the scheme pubKey is
+// tagged with. ECDSA signatures are DER encoded and must have a low S so
+// they cannot be malleated into a second valid signature.
+func verifySignature(pubKey string, digest []byte, signature []byte) error {
+	scheme, key, err := ParsePublicKey(pubKey)
+	if err != nil {
+		return err
+	}
+
+	switch scheme {
+	case SchemeRSA:
+		parsed, err := x509.ParsePKIXPublicKey(key)
+		if err != nil {
+			return fmt.Errorf("%w: public key: %v", ErrBadEncoding, err)
+		}
+		rsaKey, ok := parsed.(*rsa.PublicKey)
+		if !ok {
+			return fmt.Errorf("%w: public key is not RSA", ErrBadEncoding)
+		}
+		if rsa.VerifyPKCS1v15(rsaKey, crypto.SHA256, digest, signature) != nil {
+			return ErrBadSignature
+		}
+	case SchemeEd25519:
+		if len(key) != ed25519.PublicKeySize {
+			return fmt.Errorf("%w: ed25519 public key is %d bytes", ErrBadEncoding, len(key))
+		}
+		if !ed25519.Verify(key, digest, signature) {
+			return ErrBadSignature
+		}
+	case SchemeP256:
+		x, y := elliptic.UnmarshalCompressed(elliptic.P256(), key)
+		if x == nil {
+			return fmt.Errorf("%w: p256 public key is not a compressed point", ErrBadEncoding)
+		}
+		if !ecdsa.VerifyASN1(&ecdsa.PublicKey{Curve: elliptic.P256(), X: x, Y: y}, digest, signature) || !lowS(signature) {
+			return ErrBadSignature
+		}
+	case SchemeSecp256k1:
+		secpKey, err := secp256k1.ParsePubKey(key)
+		if err != nil {
+			return fmt.Errorf("%w: secp256k1 public key: %v", ErrBadEncoding, err)
+		}
+		sig, err := secpecdsa.ParseDERSignature(signature)
+		if err != nil {
+			return ErrBadSignature
+		}
+		// Serialize canonicalises S to the lower half of the order.
+		if !bytes.Equal(sig.Serialize(), signature) || !sig.Verify(digest, secpKey) {
+			return ErrBadSignature
+		}
+	default:
+		return fmt.Errorf("%w: %q", ErrUnknownScheme, scheme)
+	}
+
+	return nil
+}
+
+var p256HalfOrder = new(big.Int).Rsh(elliptic.P256().Params().N, 1)
+
+func lowS(signature []byte) bool {
+	var sig struct{ R, S *big.Int }
+	if _, err := asn1.Unmarshal(signature, &sig); err != nil {
+		return false
+	}
+	return sig.S.Cmp(p256HalfOrder) <= 0
+}
@@ -0,0 +1,142 @@
+package script_test
+
+import (
+	"crypto/ecdsa"
+	"crypto/ed25519"
+	"crypto/elliptic"
+	"crypto/rand"
+	"encoding/asn1"
+	"encoding/base64"
+	"errors"
+	"math/big"
+	"script"
+	"testing"
+
+	"github.com/decred/dcrd/dcrec/secp256k1/v4"
+	secpecdsa "github.com/decred/dcrd/dcrec/secp256k1/v4/ecdsa"
+)
+
+type schemeKey struct {
+	pubKey string
+	sign   func(digest []byte) []byte
+}
+
+func newSchemeKeys(t *testing.T) map[string]schemeKey {
+	_, edKey, err := ed25519.GenerateKey(rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	p256Key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	secpKey, err := secp256k1.GeneratePrivateKey()
+	if err != nil {
+		t.Fatal(err)
+	}
+	rsaKey := newRSASigners(t, 1)[0]
+
+	return map[string]schemeKey{
+		script.SchemeRSA: {
+			pubKey: rsaKey.pubKey,
+			sign:   func(digest []byte) []byte { return decodeSignature(rsaKey.sign(digest)) },
+		},
+		script.SchemeEd25519: {
+			pubKey: script.EncodePublicKey(script.SchemeEd25519, edKey.Public().(ed25519.PublicKey)),
+			sign:   func(digest []byte) []byte { return ed25519.Sign(edKey, digest) },
+		},
+		script.SchemeP256: {
+			pubKey: script.EncodePublicKey(script.SchemeP256, elliptic.MarshalCompressed(elliptic.P256(), p256Key.X, p256Key.Y)),
+			sign:   func(digest []byte) []byte { return signP256LowS(t, p256Key, digest) },
+		},
+		script.SchemeSecp256k1: {
+			pubKey: script.EncodePublicKey(script.SchemeSecp256k1, secpKey.PubKey().SerializeCompressed()),
+			sign:   func(digest []byte) []byte { return secpecdsa.Sign(secpKey, digest).Serialize() },
+		},
+	}
+}
+
+func signP256LowS(t *testing.T, key *ecdsa.PrivateKey, digest []byte) []byte {
+	r, s, err := ecdsa.Sign(rand.Reader, key, digest)
+	if err != nil {
+		t.Fatal(err)
+	}
+	n := elliptic.P256().Params().N
+	if s.Cmp(new(big.Int).Rsh(n, 1)) > 0 {
+		s.Sub(n, s)
+	}
+	return marshalECDSA(r, s)
+}
+
+func marshalECDSA(r, s *big.Int) []byte {
+	der, _ := asn1.Marshal(struct{ R, S *big.Int }{r, s})
+	return der
+}
+
+func decodeSignature(signature string) []byte {
+	raw, _ := base64.StdEncoding.DecodeString(signature)
+	return raw[:len(raw)-1]
+}
+
+func TestCheckSigSchemes(t *testing.T) {
+	for scheme, key := range newSchemeKeys(t) {
+		s := "--- sig OPDup " + key.pubKey + " OPCheckSig"
+		ctx := script.Context{
+			Args:    map[string]string{"sig": script.EncodeSignature(key.sign(multiSigDigest[:]), script.SigHashAll)},
+			SigHash: func(byte) ([]byte, error) { return multiSigDigest[:], nil },
+		}
+		if err := script.EvalScript(s, ctx); err != nil {
+			t.Fatalf("Got %v, expected a valid %s signature to be accepted", err, scheme)
+		}
+
+		ctx.Args = map[string]string{"sig": script.EncodeSignature(key.sign(otherDigest[:]), script.SigHashAll)}
+		if err := script.EvalScript(s, ctx); !errors.Is(err, script.ErrEvalFalse) {
+			t.Fatalf("Got %v, expected ErrEvalFalse for a %s signature of another digest", err, scheme)
+		}
+	}
+}
+
+func TestCheckSigHighS(t *testing.T) {
+	keys := newSchemeKeys(t)
+	ctx := script.Context{SigHash: func(byte) ([]byte, error) { return multiSigDigest[:], nil }}
+
+	for _, scheme := range []string{script.SchemeP256, script.SchemeSecp256k1} {
+		signature := keys[scheme].sign(multiSigDigest[:])
+		var sig struct{ R, S *big.Int }
+		asn1.Unmarshal(signature, &sig)
+
+		n := elliptic.P256().Params().N
+		if scheme == script.SchemeSecp256k1 {
+			n = secp256k1.Params().N
+		}
+		highS := marshalECDSA(sig.R, new(big.Int).Sub(n, sig.S))
+
+		err := script.CheckSignature(keys[scheme].pubKey, script.EncodeSignature(highS, script.SigHashAll), ctx)
+		if !errors.Is(err, script.ErrBadSignature) {
+			t.Fatalf("Got %v, expected ErrBadSignature for a high S %s signature", err, scheme)
+		}
+	}
+}
+
+func TestCheckSigBadKeys(t *testing.T) {
+	signature := script.EncodeSignature(make([]byte, 64), script.SigHashAll)
+	ctx := script.Context{SigHash: func(byte) ([]byte, error) { return multiSigDigest[:], nil }}
+
+	tests := []struct {
+		pubKey string
+		err    error
+	}{
+		{"dsa:00", script.ErrUnknownScheme},
+		{"ed25519:zz", script.ErrBadEncoding},
+		{"ed25519:0011", script.ErrBadEncoding},
+		{"p256:02ff", script.ErrBadEncoding},
+		{"secp256k1:02ff", script.ErrBadEncoding},
+		{"bm90IGEgcGVt", script.ErrBadEncoding},
+	}
+
+	for _, test := range tests {
+		if err := script.CheckSignature(test.pubKey, signature, ctx); !errors.Is(err, test.err) {
+			t.Fatalf("CheckSignature(%q) == %v, expected %v", test.pubKey, err, test.err)
+		}
+	}
+}
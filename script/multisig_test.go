@@ -0,0 +1,130 @@
+package script_test
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"crypto/x509"
+	"encoding/base64"
+	"encoding/pem"
+	"errors"
+	"script"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+var (
+	multiSigDigest = sha256.Sum256([]byte("spending transaction"))
+	otherDigest    = sha256.Sum256([]byte("another transaction"))
+)
+
+type rsaSigner struct {
+	key    *rsa.PrivateKey
+	pubKey string
+}
+
+// newRSASigners generates n RSA keys along with their base64 PEM public keys,
+// the encoding of untagged keys.
+func newRSASigners(t *testing.T, n int) []rsaSigner {
+	keys := make([]rsaSigner, n)
+	for i := range keys {
+		key, err := rsa.GenerateKey(rand.Reader, 1024)
+		if err != nil {
+			t.Fatal(err)
+		}
+		der, _ := x509.MarshalPKIXPublicKey(&key.PublicKey)
+		keys[i] = rsaSigner{key: key, pubKey: base64.StdEncoding.EncodeToString(pem.EncodeToMemory(&pem.Block{Type: "PUBLIC KEY", Bytes: der}))}
+	}
+	return keys
+}
+
+func (k rsaSigner) sign(digest []byte) string {
+	signature, _ := rsa.SignPKCS1v15(nil, k.key, crypto.SHA256, digest)
+	return script.EncodeSignature(signature, script.SigHashAll)
+}
+
+// multiSigScript locks with m of keys and unlocks with the sig1, sig2... args.
+func multiSigScript(m int, signatures int, keys []rsaSigner, opcode string) string {
+	var tokens []string
+	for i := 1; i <= signatures; i++ {
+		tokens = append(tokens, "sig"+strconv.Itoa(i)+" OPDup")
+	}
+	tokens = append(tokens, strconv.Itoa(m))
+	for _, k := range keys {
+		tokens = append(tokens, k.pubKey)
+	}
+	tokens = append(tokens, strconv.Itoa(len(keys)), opcode)
+
+	return "--- " + strings.Join(tokens, " ")
+}
+
+func multiSigContext(signatures ...string) script.Context {
+	args := make(map[string]string)
+	for i, signature := range signatures {
+		args["sig"+strconv.Itoa(i+1)] = signature
+	}
+
+	return script.Context{
+		Args:    args,
+		SigHash: func(byte) ([]byte, error) { return multiSigDigest[:], nil },
+	}
+}
+
+func TestOPCheckMultiSig(t *testing.T) {
+	keys := newRSASigners(t, 3)
+	alice, bob, arbiter := keys[0], keys[1], keys[2]
+	s := multiSigScript(2, 2, keys, "OPCheckMultiSig")
+
+	valid := [][]rsaSigner{{alice, bob}, {alice, arbiter}, {bob, arbiter}}
+	for _, signers := range valid {
+		ctx := multiSigContext(signers[0].sign(multiSigDigest[:]), signers[1].sign(multiSigDigest[:]))
+		if err := script.EvalScript(s, ctx); err != nil {
+			t.Fatalf("Got %v, expected 2 of 3 signatures to unlock", err)
+		}
+	}
+
+	// Signatures out of key order, repeated or partially invalid do not count.
+	invalid := map[string]script.Context{
+		"out of order":   multiSigContext(bob.sign(multiSigDigest[:]), alice.sign(multiSigDigest[:])),
+		"same signer":    multiSigContext(alice.sign(multiSigDigest[:]), alice.sign(multiSigDigest[:])),
+		"partial":        multiSigContext(alice.sign(multiSigDigest[:]), bob.sign(otherDigest[:])),
+		"foreign signer": multiSigContext(alice.sign(multiSigDigest[:]), newRSASigners(t, 1)[0].sign(multiSigDigest[:])),
+	}
+	for name, ctx := range invalid {
+		if err := script.EvalScript(s, ctx); !errors.Is(err, script.ErrEvalFalse) {
+			t.Fatalf("%s: Got %v, expected ErrEvalFalse", name, err)
+		}
+	}
+
+	verify := multiSigScript(2, 2, keys, "OPCheckMultiSigVerify") + " 1"
+	if err := script.EvalScript(verify, invalid["out of order"]); !errors.Is(err, script.ErrBadSignature) {
+		t.Fatalf("Got %v, expected ErrBadSignature", err)
+	}
+}
+
+func TestOPCheckMultiSigCounts(t *testing.T) {
+	keys := newRSASigners(t, 2)
+	signature := keys[0].sign(multiSigDigest[:])
+
+	// 1 of 2 with a single signature.
+	if err := script.EvalScript(multiSigScript(1, 1, keys, "OPCheckMultiSig"), multiSigContext(signature)); err != nil {
+		t.Fatalf("Got %v, expected 1 of 2 to unlock", err)
+	}
+	// 0 of 2 needs no signature at all.
+	if err := script.EvalScript(multiSigScript(0, 0, keys, "OPCheckMultiSig"), multiSigContext()); err != nil {
+		t.Fatalf("Got %v, expected 0 of 2 to unlock", err)
+	}
+	// 2 of 2 with a single signature on the stack.
+	if err := script.EvalScript(multiSigScript(2, 1, keys, "OPCheckMultiSig"), multiSigContext(signature)); !errors.Is(err, script.ErrStackUnderflow) {
+		t.Fatalf("Got %v, expected ErrStackUnderflow", err)
+	}
+	// More signatures required than keys.
+	if err := script.EvalScript(multiSigScript(3, 3, keys, "OPCheckMultiSig"), multiSigContext(signature, signature, signature)); !errors.Is(err, script.ErrBadEncoding) {
+		t.Fatalf("Got %v, expected ErrBadEncoding", err)
+	}
+	if err := script.EvalScript("--- 0 21 OPCheckMultiSig", multiSigContext()); !errors.Is(err, script.ErrBadEncoding) {
+		t.Fatalf("Got %v, expected ErrBadEncoding for more than %d keys", err, script.MaxMultiSigKeys)
+	}
+}
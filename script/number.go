@@ -0,0 +1,94 @@
+package script
+
+import (
+	"fmt"
+	"math/big"
+	"regexp"
+	"strings"
+)
+
+// Numbers are stack elements written as decimals, such as "21" or "-0.5",
+// with at most MaxNumberDecimals digits after the point. They are read
+// exactly so that settling on weather values never depends on float
+// rounding, and results are written by FormatNumber.
+const MaxNumberDecimals = 18
+
+var matchDecimal = regexp.MustCompile(`^-?[0-9]+(\.[0-9]+)?$`)
+
+func ParseNumber(element string) (*big.Rat, error) {
+	if !matchDecimal.MatchString(element) {
+		return nil, fmt.Errorf("%w: %q is not a number", ErrBadEncoding, element)
+	}
+	if _, decimals, ok := strings.Cut(element, "."); ok && len(decimals) > MaxNumberDecimals {
+		return nil, fmt.Errorf("%w: %q has more than %d decimals", ErrBadEncoding, element, MaxNumberDecimals)
+	}
+
+	number, _ := new(big.Rat).SetString(element)
+	return number, nil
+}
+
+// FormatNumber writes n in its shortest decimal form, without trailing zeros
+// or a negative zero. n must have at most MaxNumberDecimals decimals, as do
+// sums and differences of parsed numbers.
+func FormatNumber(n *big.Rat) string {
+	res := n.FloatString(MaxNumberDecimals)
+	res = strings.TrimRight(res, "0")
+	res = strings.TrimSuffix(res, ".")
+
+	if res == "-0" || res == "" {
+		return "0"
+	}
+	return res
+}
+
+func parseNumbers(elements ...string) ([]*big.Rat, error) {
+	numbers := make([]*big.Rat, len(elements))
+	for i, element := range elements {
+		number, err := ParseNumber(element)
+		if err != nil {
+			return nil, err
+		}
+		numbers[i] = number
+	}
+
+	return numbers, nil
+}
+
+// evalNumeric applies a binary numeric opcode to a and b, where b was on top
+// of the stack, e.g. "a b OPSub" pushes a - b.
+func evalNumeric(instruction string, a, b string) (string, error) {
+	numbers, err := parseNumbers(a, b)
+	if err != nil {
+		return "", err
+	}
+	x, y := numbers[0], numbers[1]
+
+	switch instruction {
+	case "OPAdd":
+		return FormatNumber(new(big.Rat).Add(x, y)), nil
+	case "OPSub":
+		return FormatNumber(new(big.Rat).Sub(x, y)), nil
+	case "OPMin":
+		if x.Cmp(y) <= 0 {
+			return FormatNumber(x), nil
+		}
+		return FormatNumber(y), nil
+	case "OPMax":
+		if x.Cmp(y) >= 0 {
+			return FormatNumber(x), nil
+		}
+		return FormatNumber(y), nil
+	case "OPNumEqual":
+		return boolElement(x.Cmp(y) == 0), nil
+	case "OPLessThan":
+		return boolElement(x.Cmp(y) < 0), nil
+	case "OPGreaterThan":
+		return boolElement(x.Cmp(y) > 0), nil
+	case "OPLessThanOrEqual":
+		return boolElement(x.Cmp(y) <= 0), nil
+	case "OPGreaterThanOrEqual":
+		return boolElement(x.Cmp(y) >= 0), nil
+	}
+
+	return "", ErrUnknownOpcode
+}
@@ -0,0 +1,82 @@
+package script_test
+
+import (
+	"errors"
+	"script"
+	"strings"
+	"testing"
+)
+
+func TestNumberEncoding(t *testing.T) {
+	tests := map[string]string{
+		"21":     "21",
+		"021":    "21",
+		"-0":     "0",
+		"0.400":  "0.4",
+		"-3.50":  "-3.5",
+		"10.000": "10",
+	}
+
+	for element, expected := range tests {
+		number, err := script.ParseNumber(element)
+		if err != nil {
+			t.Fatalf("ParseNumber(%q): %v", element, err)
+		}
+		if formatted := script.FormatNumber(number); formatted != expected {
+			t.Fatalf("FormatNumber(ParseNumber(%q)) == %q, expected %q", element, formatted, expected)
+		}
+	}
+
+	invalid := []string{"", "1e3", "1/3", "+1", ".5", "1.", "0x10", "1." + strings.Repeat("0", script.MaxNumberDecimals+1)}
+	for _, element := range invalid {
+		if _, err := script.ParseNumber(element); !errors.Is(err, script.ErrBadEncoding) {
+			t.Fatalf("ParseNumber(%q) == %v, expected ErrBadEncoding", element, err)
+		}
+	}
+}
+
+func TestNumericOpcodes(t *testing.T) {
+	tests := map[string]string{
+		"--- 10.5 2.25 OPAdd":            "12.75",
+		"--- 0.1 0.2 OPAdd":              "0.3",
+		"--- 2 10.5 OPSub":               "-8.5",
+		"--- 0.3 0.1 OPSub":              "0.2",
+		"--- -4 2 OPMin":                 "-4",
+		"--- -4 2 OPMax":                 "2",
+		"--- 10 10.0 OPNumEqual":         "1",
+		"--- 10 10.01 OPNumEqual":        "0",
+		"--- 9.99 10 OPLessThan":         "1",
+		"--- 10 10 OPLessThan":           "0",
+		"--- 10 10 OPLessThanOrEqual":    "1",
+		"--- 10.01 10 OPGreaterThan":     "1",
+		"--- 9 10 OPGreaterThanOrEqual":  "0",
+		"--- 10 10 OPGreaterThanOrEqual": "1",
+	}
+
+	for s, expected := range tests {
+		if err := script.EvalScript(s+" "+expected+" OPEqualVerify 1", script.Context{}); err != nil {
+			t.Fatalf("EvalScript(%q) == %v, expected %s on top", s, err, expected)
+		}
+	}
+
+	if err := script.EvalScript("--- 1 rain OPAdd", script.Context{}); !errors.Is(err, script.ErrBadEncoding) {
+		t.Fatalf("Got %v, expected ErrBadEncoding", err)
+	}
+}
+
+func TestRainThreshold(t *testing.T) {
+	// "More than 10mm of rain" after summing two half-day readings.
+	s := "--- 4.5 6 OPAdd 10 OPGreaterThan"
+	if err := script.EvalScript(s, script.Context{}); err != nil {
+		t.Fatalf("Got %v, expected 10.5mm to be more than 10mm", err)
+	}
+
+	s = "--- 4.5 5.5 OPAdd 10 OPGreaterThan"
+	if err := script.EvalScript(s, script.Context{}); !errors.Is(err, script.ErrEvalFalse) {
+		t.Fatalf("Got %v, expected 10mm not to be more than 10mm", err)
+	}
+
+	if err := script.EvalScript("--- 0.0", script.Context{}); !errors.Is(err, script.ErrEvalFalse) {
+		t.Fatalf("Got %v, expected 0.0 to be false", err)
+	}
+}
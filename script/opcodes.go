@@ -0,0 +1,77 @@
+package script
+
+// Opcode is the bytecode value of an instruction. Values follow Bitcoin's
+// where an opcode has a counterpart there, so a disassembled script reads
+// familiarly next to a Bitcoin one.
+type Opcode byte
+
+// Bytecode values below OpPushData1 that are not the separator push that
+// many bytes of data.
+const (
+	OpSeparator Opcode = 0x00
+	OpPushData1 Opcode = 0x4c
+	OpPushData2 Opcode = 0x4d
+)
+
+var opcodeNames = map[Opcode]string{
+	0x63: "OPIf",
+	0x64: "OPNotIf",
+	0x67: "OPElse",
+	0x68: "OPEndIf",
+	0x69: "OPVerify",
+	0x74: "OPDepth",
+	0x75: "OPDrop",
+	0x76: "OPDup",
+	0x77: "OPNip",
+	0x78: "OPOver",
+	0x79: "OPPick",
+	0x7a: "OPRoll",
+	0x7b: "OPRot",
+	0x7c: "OPSwap",
+	0x7d: "OPTuck",
+	0x87: "OPEqual",
+	0x88: "OPEqualVerify",
+	0x91: "OPNot",
+	0x93: "OPAdd",
+	0x94: "OPSub",
+	0x9c: "OPNumEqual",
+	0x9f: "OPLessThan",
+	0xa0: "OPGreaterThan",
+	0xa1: "OPLessThanOrEqual",
+	0xa2: "OPGreaterThanOrEqual",
+	0xa3: "OPMin",
+	0xa4: "OPMax",
+	0xa5: "OPWithin",
+	0xa6: "OPRipemd160",
+	0xa8: "OPHash",
+	0xa9: "OPHash160",
+	0xaa: "OPSha256d",
+	0xac: "OPCheckSig",
+	0xad: "OPCheckSigVerify",
+	0xae: "OPCheckMultiSig",
+	0xaf: "OPCheckMultiSigVerify",
+	0xb1: "OPCheckLockTimeVerify",
+	0xb2: "OPCheckSequenceVerify",
+	0xc0: "OPCheckThirdParty",
+	0xc1: "OPHash3",
+}
+
+var opcodesByName = make(map[string]Opcode, len(opcodeNames))
+
+func init() {
+	for op, name := range opcodeNames {
+		opcodesByName[name] = op
+	}
+}
+
+func LookupOpcode(name string) (Opcode, bool) {
+	op, ok := opcodesByName[name]
+	return op, ok
+}
+
+func (op Opcode) String() string {
+	if name, ok := opcodeNames[op]; ok {
+		return name
+	}
+	return "OPUnknown"
+}
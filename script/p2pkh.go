@@ -0,0 +1,13 @@
+package script
+
+// PayToPubKeyHash locks funds to the key whose OPHash is pubKeyHash. It reads
+// the signature and key from the stack, as pushed by PubKeyHashSig, instead
+// of from named arguments.
+func PayToPubKeyHash(pubKeyHash string) string {
+	return "--- 0 OPPick OPHash " + pubKeyHash + " OPEqualVerify OPCheckSig"
+}
+
+// PubKeyHashSig is the unlocking script of a PayToPubKeyHash output.
+func PubKeyHashSig(signature, pubKey string) string {
+	return signature + " " + pubKey
+}
@@ -0,0 +1,66 @@
+package script
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"strings"
+)
+
+// RedeemScriptArg is the argument revealing the redeem script when spending
+// a pay-to-script-hash output.
+const RedeemScriptArg = "redeemScript"
+
+var ErrScriptHashMismatch = errors.New("redeem script does not match script hash")
+
+// PayToScriptHash returns a short output script committing to the redeem
+// script whose OPHash is address. Spending it runs the redeem script instead,
+// see RedeemScript.
+func PayToScriptHash(address string) string {
+	return RedeemScriptArg + " --- " + RedeemScriptArg + " OPDup OPHash " + address + " OPEqual"
+}
+
+// IsPayToScriptHash reports whether s is exactly a PayToScriptHash output
+// script, and the address it pays to.
+func IsPayToScriptHash(s string) (string, bool) {
+	tokens := strings.Fields(s)
+	if len(tokens) != 7 {
+		return "", false
+	}
+
+	address := tokens[5]
+	if hash, err := hex.DecodeString(address); err != nil || len(hash) != 32 || address != strings.ToLower(address) || s != PayToScriptHash(address) {
+		return "", false
+	}
+	return address, true
+}
+
+// RedeemScript returns the script to run to unlock an output locked by
+// lockingScript: lockingScript itself, or the redeem script revealed in args
+// for a pay-to-script-hash output. The redeem script is never pushed on the
+// stack, so it is only bound by MaxScriptSize.
+func RedeemScript(lockingScript string, args map[string]string) (string, error) {
+	address, ok := IsPayToScriptHash(lockingScript)
+	if !ok {
+		return lockingScript, nil
+	}
+
+	redeemScript, ok := args[RedeemScriptArg]
+	if !ok {
+		return "", fmt.Errorf("%w: %q", ErrMissingArg, RedeemScriptArg)
+	}
+	if OPHash(redeemScript) != address {
+		return "", ErrScriptHashMismatch
+	}
+	return redeemScript, nil
+}
+
+// RedeemArgs adds the redeem script to the arguments unlocking it.
+func RedeemArgs(redeemScript string, args map[string]string) map[string]string {
+	res := make(map[string]string, len(args)+1)
+	for name, arg := range args {
+		res[name] = arg
+	}
+	res[RedeemScriptArg] = redeemScript
+	return res
+}
@@ -0,0 +1,371 @@
+package script
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strings"
+	"unicode"
+	"unicode/utf8"
+)
+
+var (
+	ErrBadSeparator = errors.New("misplaced separator")
+	ErrOpcodeInArgs = errors.New("opcode in script arguments")
+)
+
+// Position locates a token in a text script by line and column, both
+// starting at 1, or in bytecode by byte offset alone.
+type Position struct {
+	Offset int
+	Line   int
+	Column int
+}
+
+func (p Position) String() string {
+	if p.Line == 0 {
+		return fmt.Sprintf("offset %d", p.Offset)
+	}
+	return fmt.Sprintf("%d:%d", p.Line, p.Column)
+}
+
+// ParseError is returned when a script cannot be parsed, with the position
+// of the offending token.
+type ParseError struct {
+	Pos   Position
+	Token string
+	Err   error
+}
+
+func (e *ParseError) Error() string {
+	if e.Token == "" {
+		return fmt.Sprintf("%s: %v", e.Pos, e.Err)
+	}
+	return fmt.Sprintf("%s: %v: %q", e.Pos, e.Err, e.Token)
+}
+
+func (e *ParseError) Unwrap() error {
+	return e.Err
+}
+
+type NodeKind int
+
+const (
+	PushNode NodeKind = iota
+	OpNode
+)
+
+// Node is a single instruction: either an opcode or a literal pushed on the
+// stack as is.
+type Node struct {
+	Kind NodeKind
+	Op   Opcode
+	Data string
+	Pos  Position
+}
+
+func (n Node) String() string {
+	if n.Kind == OpNode {
+		return n.Op.String()
+	}
+	return n.Data
+}
+
+// Script is a parsed script. Args name the values the spender supplies and
+// Instructions run once they are bound. A script without separator has no
+// instructions and can never be unlocked.
+type Script struct {
+	Args         []Node
+	Instructions []Node
+	HasSeparator bool
+}
+
+// String returns the canonical text form of the script, tokens separated by
+// single spaces.
+func (sc *Script) String() string {
+	var tokens []string
+	for _, arg := range sc.Args {
+		tokens = append(tokens, arg.String())
+	}
+	if sc.HasSeparator {
+		tokens = append(tokens, "---")
+	}
+	for _, instruction := range sc.Instructions {
+		tokens = append(tokens, instruction.String())
+	}
+
+	return strings.Join(tokens, " ")
+}
+
+type token struct {
+	text string
+	pos  Position
+}
+
+// lex splits input on whitespace, recording where each token starts.
+func lex(input string) []token {
+	var tokens []token
+	line, column := 1, 1
+	start := -1
+	var startPos Position
+
+	for offset, r := range input {
+		if unicode.IsSpace(r) {
+			if start >= 0 {
+				tokens = append(tokens, token{text: input[start:offset], pos: startPos})
+				start = -1
+			}
+		} else if start < 0 {
+			start = offset
+			startPos = Position{Offset: offset, Line: line, Column: column}
+		}
+
+		if r == '\n' {
+			line, column = line+1, 1
+		} else {
+			column++
+		}
+	}
+	if start >= 0 {
+		tokens = append(tokens, token{text: input[start:], pos: startPos})
+	}
+
+	return tokens
+}
+
+func isSeparator(text string) bool {
+	return strings.Trim(text, "-") == ""
+}
+
+// Parse turns the text form of a script into a Script. Tokens starting with
+// "OP" must be known opcodes, so that a typo fails here instead of being
+// pushed as data, and conditionals must be properly nested.
+func Parse(input string) (*Script, error) {
+	sc := &Script{}
+
+	for _, tok := range lex(input) {
+		if isSeparator(tok.text) {
+			if sc.HasSeparator {
+				return nil, &ParseError{Pos: tok.pos, Token: tok.text, Err: ErrBadSeparator}
+			}
+			sc.HasSeparator = true
+			continue
+		}
+
+		node := Node{Kind: PushNode, Data: tok.text, Pos: tok.pos}
+		if strings.HasPrefix(tok.text, "OP") {
+			op, ok := LookupOpcode(tok.text)
+			if !ok {
+				return nil, &ParseError{Pos: tok.pos, Token: tok.text, Err: ErrUnknownOpcode}
+			}
+			node = Node{Kind: OpNode, Op: op, Pos: tok.pos}
+		}
+
+		if sc.HasSeparator {
+			sc.Instructions = append(sc.Instructions, node)
+		} else if node.Kind == OpNode {
+			return nil, &ParseError{Pos: tok.pos, Token: tok.text, Err: ErrOpcodeInArgs}
+		} else {
+			sc.Args = append(sc.Args, node)
+		}
+	}
+
+	end := Position{Offset: len(input), Line: strings.Count(input, "\n") + 1}
+	end.Column = utf8.RuneCountInString(input[strings.LastIndex(input, "\n")+1:]) + 1
+	if err := checkNesting(sc.Instructions, end); err != nil {
+		return nil, err
+	}
+
+	return sc, nil
+}
+
+// ParseScript returns the arguments and instructions of a script as text.
+func ParseScript(input string) ([]string, []string, error) {
+	sc, err := Parse(input)
+	if err != nil {
+		return nil, nil, err
+	}
+
+	var args, instructions []string
+	for _, arg := range sc.Args {
+		args = append(args, arg.String())
+	}
+	for _, instruction := range sc.Instructions {
+		instructions = append(instructions, instruction.String())
+	}
+
+	return args, instructions, nil
+}
+
+// checkNesting verifies that every OPIf or OPNotIf is closed by an OPEndIf
+// and has at most one OPElse. Unclosed conditionals are reported at end.
+func checkNesting(instructions []Node, end Position) error {
+	var hasElse []bool
+
+	for _, instruction := range instructions {
+		if instruction.Kind != OpNode {
+			continue
+		}
+
+		switch instruction.Op.String() {
+		case "OPIf", "OPNotIf":
+			hasElse = append(hasElse, false)
+		case "OPElse":
+			if len(hasElse) == 0 || hasElse[len(hasElse)-1] {
+				return &ParseError{Pos: instruction.Pos, Token: instruction.String(), Err: ErrUnbalancedIf}
+			}
+			hasElse[len(hasElse)-1] = true
+		case "OPEndIf":
+			if len(hasElse) == 0 {
+				return &ParseError{Pos: instruction.Pos, Token: instruction.String(), Err: ErrUnbalancedIf}
+			}
+			hasElse = hasElse[:len(hasElse)-1]
+		}
+	}
+
+	if len(hasElse) > 0 {
+		return &ParseError{Pos: end, Err: fmt.Errorf("%w: %d OPIf without OPEndIf", ErrUnbalancedIf, len(hasElse))}
+	}
+	return nil
+}
+
+// Bytecode encodes the script for storage: every opcode is a single byte and
+// literals are length prefixed, using OpPushData1 or OpPushData2 only when
+// the length does not fit in the push byte itself.
+func (sc *Script) Bytecode() ([]byte, error) {
+	var code []byte
+
+	for _, arg := range sc.Args {
+		var err error
+		if code, err = appendNode(code, arg); err != nil {
+			return nil, err
+		}
+	}
+	if sc.HasSeparator {
+		code = append(code, byte(OpSeparator))
+	}
+	for _, instruction := range sc.Instructions {
+		var err error
+		if code, err = appendNode(code, instruction); err != nil {
+			return nil, err
+		}
+	}
+
+	return code, nil
+}
+
+func appendNode(code []byte, node Node) ([]byte, error) {
+	if node.Kind == OpNode {
+		return append(code, byte(node.Op)), nil
+	}
+
+	data := []byte(node.Data)
+	switch {
+	case len(data) > MaxElementSize:
+		return nil, &ParseError{Pos: node.Pos, Err: fmt.Errorf("%w: %d > %d bytes", ErrElementTooLarge, len(data), MaxElementSize)}
+	case len(data) < int(OpPushData1):
+		code = append(code, byte(len(data)))
+	case len(data) <= 0xff:
+		code = append(code, byte(OpPushData1), byte(len(data)))
+	default:
+		code = append(code, byte(OpPushData2))
+		code = binary.LittleEndian.AppendUint16(code, uint16(len(data)))
+	}
+
+	return append(code, data...), nil
+}
+
+// Compile parses the text form of a script and returns its bytecode.
+func Compile(input string) ([]byte, error) {
+	sc, err := Parse(input)
+	if err != nil {
+		return nil, err
+	}
+	return sc.Bytecode()
+}
+
+// ParseBytecode decodes bytecode produced by Bytecode. Pushes must use the
+// shortest encoding so that every script has a single bytecode.
+func ParseBytecode(code []byte) (*Script, error) {
+	sc := &Script{}
+
+	for offset := 0; offset < len(code); {
+		pos := Position{Offset: offset}
+		op := Opcode(code[offset])
+		offset++
+
+		var node Node
+		switch {
+		case op == OpSeparator:
+			if sc.HasSeparator {
+				return nil, &ParseError{Pos: pos, Token: "---", Err: ErrBadSeparator}
+			}
+			sc.HasSeparator = true
+			continue
+		case op <= OpPushData2:
+			length, size := int(op), 0
+			switch op {
+			case OpPushData1:
+				size = 1
+			case OpPushData2:
+				size = 2
+			}
+			if offset+size > len(code) {
+				return nil, &ParseError{Pos: pos, Err: fmt.Errorf("%w: truncated push length", ErrBadEncoding)}
+			}
+			switch op {
+			case OpPushData1:
+				length = int(code[offset])
+			case OpPushData2:
+				length = int(binary.LittleEndian.Uint16(code[offset:]))
+			}
+			offset += size
+
+			if (op == OpPushData1 && length < int(OpPushData1)) || (op == OpPushData2 && length <= 0xff) {
+				return nil, &ParseError{Pos: pos, Err: fmt.Errorf("%w: non minimal push of %d bytes", ErrBadEncoding, length)}
+			}
+			if offset+length > len(code) {
+				return nil, &ParseError{Pos: pos, Err: fmt.Errorf("%w: push of %d bytes past the end", ErrBadEncoding, length)}
+			}
+			node = Node{Kind: PushNode, Data: string(code[offset : offset+length]), Pos: pos}
+			if !textLiteral(node.Data) {
+				return nil, &ParseError{Pos: pos, Token: node.Data, Err: fmt.Errorf("%w: literal has no text form", ErrBadEncoding)}
+			}
+			offset += length
+		default:
+			if _, ok := opcodeNames[op]; !ok {
+				return nil, &ParseError{Pos: pos, Token: fmt.Sprintf("%#02x", byte(op)), Err: ErrUnknownOpcode}
+			}
+			node = Node{Kind: OpNode, Op: op, Pos: pos}
+		}
+
+		if sc.HasSeparator {
+			sc.Instructions = append(sc.Instructions, node)
+		} else if node.Kind == OpNode {
+			return nil, &ParseError{Pos: pos, Token: node.String(), Err: ErrOpcodeInArgs}
+		} else {
+			sc.Args = append(sc.Args, node)
+		}
+	}
+
+	if err := checkNesting(sc.Instructions, Position{Offset: len(code)}); err != nil {
+		return nil, err
+	}
+
+	return sc, nil
+}
+
+// textLiteral reports whether data reads back as the same literal once
+// disassembled.
+func textLiteral(data string) bool {
+	return !isSeparator(data) && !strings.HasPrefix(data, "OP") && !strings.ContainsFunc(data, unicode.IsSpace)
+}
+
+// Disassemble returns the canonical text form of bytecode.
+func Disassemble(code []byte) (string, error) {
+	sc, err := ParseBytecode(code)
+	if err != nil {
+		return "", err
+	}
+	return sc.String(), nil
+}
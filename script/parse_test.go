@@ -0,0 +1,122 @@
+package script_test
+
+import (
+	"bytes"
+	"errors"
+	"script"
+	"strings"
+	"testing"
+)
+
+func TestParseTokens(t *testing.T) {
+	sc, err := script.Parse("sig pubKey ---\n  pubKey OPDup\tOPHash 12 OPEqualVerify")
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	if len(sc.Args) != 2 || sc.Args[1].Data != "pubKey" || !sc.HasSeparator {
+		t.Fatalf("Got args %v, expected sig pubKey before the separator", sc.Args)
+	}
+
+	expected := []struct {
+		kind script.NodeKind
+		text string
+		pos  script.Position
+	}{
+		{script.PushNode, "pubKey", script.Position{Offset: 17, Line: 2, Column: 3}},
+		{script.OpNode, "OPDup", script.Position{Offset: 24, Line: 2, Column: 10}},
+		{script.OpNode, "OPHash", script.Position{Offset: 30, Line: 2, Column: 16}},
+		{script.PushNode, "12", script.Position{Offset: 37, Line: 2, Column: 23}},
+		{script.OpNode, "OPEqualVerify", script.Position{Offset: 40, Line: 2, Column: 26}},
+	}
+	if len(sc.Instructions) != len(expected) {
+		t.Fatalf("Got %d instructions, expected %d", len(sc.Instructions), len(expected))
+	}
+	for i, node := range sc.Instructions {
+		if node.Kind != expected[i].kind || node.String() != expected[i].text || node.Pos != expected[i].pos {
+			t.Fatalf("Instruction %d == %+v, expected %+v", i, node, expected[i])
+		}
+	}
+}
+
+func TestParseErrors(t *testing.T) {
+	tests := []struct {
+		script string
+		err    error
+		pos    string
+	}{
+		{"sig --- sig OPDup\nOPEqualVerfy", script.ErrUnknownOpcode, "2:1"},
+		{"--- a --- b", script.ErrBadSeparator, "1:7"},
+		{"sig OPDup --- 1", script.ErrOpcodeInArgs, "1:5"},
+		{"--- 1 OPIf a OPElse b OPElse", script.ErrUnbalancedIf, "1:23"},
+		{"--- 1 OPIf\n a", script.ErrUnbalancedIf, "2:3"},
+	}
+
+	for _, test := range tests {
+		_, err := script.Parse(test.script)
+		var parseErr *script.ParseError
+		if !errors.Is(err, test.err) || !errors.As(err, &parseErr) || parseErr.Pos.String() != test.pos {
+			t.Fatalf("Parse(%q) == %v, expected %v at %s", test.script, err, test.err, test.pos)
+		}
+	}
+
+	// Typos used to be pushed as data, now nothing runs.
+	if err := script.EvalScript("--- a a OPEqualVerfy 1", script.Context{}); !errors.Is(err, script.ErrUnknownOpcode) {
+		t.Fatalf("Got %v, expected ErrUnknownOpcode", err)
+	}
+}
+
+func TestCompileDisassemble(t *testing.T) {
+	tests := []string{
+		"",
+		"alice",
+		"sign pubKey --- pubKey OPDup OPHash 3e4c25fe2d8751520c0b444d3e43a955feb782f10b25c68acebfe8c29dc63c91 OPEqualVerify sign OPDup pubKey OPDup OPCheckSig",
+		"--- 1 OPIf 20.5 OPElse -3 OPEndIf 2 OPPick",
+		"--- preimage OPDup " + script.HashLock("00") + " 1 OPSha256d OPRipemd160 OPHash3 OPDrop",
+		script.PayToScriptHash(script.OPHash("--- 1")),
+		"--- " + strings.Repeat("a", 0x4b) + " " + strings.Repeat("b", 0x4c) + " " + strings.Repeat("c", 0x100),
+	}
+
+	for _, text := range tests {
+		code, err := script.Compile(text)
+		if err != nil {
+			t.Fatalf("Compile(%q) == %v", text, err)
+		}
+		disassembled, err := script.Disassemble(code)
+		if err != nil || disassembled != text {
+			t.Fatalf("Disassemble(Compile(%q)) == %q, %v", text, disassembled, err)
+		}
+	}
+
+	code, _ := script.Compile("a ---\n\n a OPDup 1 OPEqual")
+	expected := []byte{0x01, 'a', 0x00, 0x01, 'a', 0x76, 0x01, '1', 0x87}
+	if !bytes.Equal(code, expected) {
+		t.Fatalf("Got bytecode %x, expected %x", code, expected)
+	}
+	if len(code) >= len("a --- a OPDup 1 OPEqual") {
+		t.Fatalf("Bytecode is %d bytes, expected it shorter than the text", len(code))
+	}
+}
+
+func TestParseBytecodeErrors(t *testing.T) {
+	tests := []struct {
+		code []byte
+		err  error
+	}{
+		{[]byte{0x00, 0x05, 'a'}, script.ErrBadEncoding},
+		{[]byte{0x00, 0x4c}, script.ErrBadEncoding},
+		{[]byte{0x00, 0x4c, 0x01, 'a'}, script.ErrBadEncoding},
+		{[]byte{0x00, 0x02, 'O', 'P'}, script.ErrBadEncoding},
+		{[]byte{0x00, 0x03, 'a', ' ', 'b'}, script.ErrBadEncoding},
+		{[]byte{0x00, 0x50}, script.ErrUnknownOpcode},
+		{[]byte{0x00, 0x00}, script.ErrBadSeparator},
+		{[]byte{0x76, 0x00}, script.ErrOpcodeInArgs},
+		{[]byte{0x00, 0x01, '1', 0x63}, script.ErrUnbalancedIf},
+	}
+
+	for _, test := range tests {
+		if _, err := script.Disassemble(test.code); !errors.Is(err, test.err) {
+			t.Fatalf("Disassemble(%x) == %v, expected %v", test.code, err, test.err)
+		}
+	}
+}
@@ -1,67 +1,562 @@
 package script
 
 import (
-	"crypto"
-	"crypto/rsa"
 	"crypto/sha256"
-	"crypto/x509"
 	"encoding/base64"
 	"encoding/hex"
-	"encoding/pem"
-	"github.com/tidwall/gjson"
+	"errors"
+	"fmt"
 	"internal/stack"
-	"io"
-	"log"
-	"net/http"
-	"regexp"
+	"oracle"
+	"strconv"
+	"strings"
 )
 
-func ParseScript(input string) ([]string, []string) {
-	matchTokenDelimiter := regexp.MustCompile(`\s+|\n+]`)
-	inputTokens := matchTokenDelimiter.Split(input, -1)
-	var args []string
-	var instructions []string
+// Lock times below LockTimeThreshold are block heights, the others unix
+// timestamps. Sequence numbers encode relative lock times as in BIP 68.
+const (
+	LockTimeThreshold = 500000000
 
-	matchArgsDelimiter := regexp.MustCompile(`^-+$`)
-	for idx, token := range inputTokens {
-		if matchArgsDelimiter.MatchString(token) {
-			args = inputTokens[:idx]
-			instructions = inputTokens[idx+1:]
-			break
+	SequenceFinal               uint32 = 0xffffffff
+	SequenceLockTimeDisableFlag uint32 = 1 << 31
+	SequenceLockTimeTypeFlag    uint32 = 1 << 22
+	SequenceLockTimeMask        uint32 = 0x0000ffff
+	SequenceLockTimeGranularity        = 9
+)
+
+// Signatures are the base64 encoding of the raw signature followed by a hash
+// type byte selecting which parts of the spending transaction it commits to.
+const (
+	SigHashAll          byte = 0x01
+	SigHashNone         byte = 0x02
+	SigHashSingle       byte = 0x03
+	SigHashAnyoneCanPay byte = 0x80
+)
+
+// Consensus limits on script evaluation. Ops are the instructions that are
+// not data pushes, elements are the strings pushed onto the stack.
+const (
+	MaxScriptSize  = 10000
+	MaxOps         = 201
+	MaxStackSize   = 1000
+	MaxElementSize = 2048
+
+	MaxMultiSigKeys = 20
+)
+
+var (
+	ErrScriptTooLarge      = errors.New("script too large")
+	ErrTooManyOps          = errors.New("too many ops")
+	ErrStackOverflow       = errors.New("stack overflow")
+	ErrElementTooLarge     = errors.New("stack element too large")
+	ErrEvalFalse           = errors.New("script evaluated to false")
+	ErrStackUnderflow      = errors.New("stack underflow")
+	ErrUnbalancedIf        = errors.New("unbalanced conditional")
+	ErrBadEncoding         = errors.New("bad encoding")
+	ErrUnknownOpcode       = errors.New("unknown opcode")
+	ErrMissingArg          = errors.New("missing script argument")
+	ErrVerifyFailed        = errors.New("verify failed")
+	ErrBadSignature        = errors.New("signature verification failed")
+	ErrUnknownSigHashType  = errors.New("unknown signature hash type")
+	ErrNoTransaction       = errors.New("no spending transaction to sign")
+	ErrUnsatisfiedLockTime = errors.New("lock time not satisfied")
+)
+
+// EvalError is returned by EvalScript with the index of the instruction that
+// failed, counted from the script separator.
+type EvalError struct {
+	Index       int
+	Instruction string
+	Err         error
+}
+
+func (e *EvalError) Error() string {
+	return fmt.Sprintf("instruction %d (%s): %v", e.Index, e.Instruction, e.Err)
+}
+
+func (e *EvalError) Unwrap() error {
+	return e.Err
+}
+
+// Context is the spending transaction as seen by the input being unlocked.
+// SigHash returns the digest a signature with the given hash type signs.
+// When set, Trace is called after every instruction that did not fail.
+type Context struct {
+	Args     map[string]string
+	LockTime int64
+	Sequence uint32
+	SigHash  func(hashType byte) ([]byte, error)
+	Trace    func(step TraceStep)
+}
+
+// TraceStep is the stack, from bottom to top, left by an instruction.
+// Instructions in a branch not taken are traced but not executed. The pushes
+// of an unlocking script come first, at Position "sig".
+type TraceStep struct {
+	Index       int
+	Instruction string
+	Position    string
+	Executed    bool
+	Stack       []string
+}
+
+func ValidSigHashType(hashType byte) bool {
+	base := hashType &^ SigHashAnyoneCanPay
+	return base >= SigHashAll && base <= SigHashSingle
+}
+
+func EncodeSignature(signature []byte, hashType byte) string {
+	return base64.StdEncoding.EncodeToString(append(signature[:len(signature):len(signature)], hashType))
+}
+
+// EvalScript runs script against ctx. It succeeds when no instruction fails
+// and the stack is left with a truthy value on top.
+func EvalScript(script string, ctx Context) error {
+	return VerifyScript("", script, ctx)
+}
+
+// VerifyScript unlocks lockingScript with the push only unlocking script
+// scriptSig: every whitespace separated token of scriptSig is pushed in
+// order, as data even when it looks like an opcode, then lockingScript runs
+// on the resulting stack. Named arguments in ctx are still available to
+// OPDup, for scripts written before unlocking scripts existed.
+func VerifyScript(scriptSig string, lockingScript string, ctx Context) error {
+	if len(scriptSig) > MaxScriptSize {
+		return fmt.Errorf("%w: unlocking script %d > %d bytes", ErrScriptTooLarge, len(scriptSig), MaxScriptSize)
+	}
+
+	s := stack.Stack{}
+	for idx, data := range strings.Fields(scriptSig) {
+		s.Push(data)
+		if err := checkStack(&s); err != nil {
+			return fmt.Errorf("unlocking script: %w", err)
+		}
+		if ctx.Trace != nil {
+			ctx.Trace(TraceStep{Index: idx, Instruction: data, Position: "sig", Executed: true, Stack: s.Items()})
 		}
 	}
 
-	return args, instructions
+	if err := evalScript(&s, lockingScript, ctx); err != nil {
+		return err
+	}
+
+	top, err := s.Top()
+	if err != nil || !IsTruthy(top) {
+		return ErrEvalFalse
+	}
+
+	return nil
 }
 
-func EvalScript(script string, args map[string]string) bool {
-	_, instructions := ParseScript(script)
-	s := stack.Stack{}
+func evalScript(s *stack.Stack, script string, ctx Context) error {
+	if len(script) > MaxScriptSize {
+		return fmt.Errorf("%w: %d > %d bytes", ErrScriptTooLarge, len(script), MaxScriptSize)
+	}
+
+	sc, err := Parse(script)
+	if err != nil {
+		return err
+	}
+
+	ops := 0
+	var branches []bool
+
+	for idx, node := range sc.Instructions {
+		instruction := node.String()
+		if node.Kind == OpNode {
+			ops++
+		}
+
+		executed := executing(branches)
+		if instruction == "OPElse" || instruction == "OPEndIf" {
+			executed = executing(branches[:len(branches)-1])
+		}
+
+		var err error
+		switch {
+		case ops > MaxOps:
+			err = fmt.Errorf("%w: more than %d", ErrTooManyOps, MaxOps)
+		case isConditional(instruction):
+			branches, err = evalConditional(s, branches, instruction)
+		case !executed:
+		case node.Kind == PushNode:
+			s.Push(node.Data)
+			err = checkStack(s)
+		default:
+			if err = evalInstruction(s, instruction, ctx); err == nil {
+				err = checkStack(s)
+			}
+		}
+		if err != nil {
+			return &EvalError{Index: idx, Instruction: instruction, Err: err}
+		}
+
+		if ctx.Trace != nil {
+			ctx.Trace(TraceStep{Index: idx, Instruction: instruction, Position: node.Pos.String(), Executed: executed, Stack: s.Items()})
+		}
+	}
+
+	return nil
+}
+
+// Trace evaluates lockingScript like VerifyScript and returns every step it
+// went through, up to the failing instruction if any.
+func Trace(scriptSig string, lockingScript string, ctx Context) ([]TraceStep, error) {
+	var steps []TraceStep
+	trace := ctx.Trace
+	ctx.Trace = func(step TraceStep) {
+		steps = append(steps, step)
+		if trace != nil {
+			trace(step)
+		}
+	}
+
+	err := VerifyScript(scriptSig, lockingScript, ctx)
+	return steps, err
+}
+
+// branches holds, for every enclosing OPIf, whether the current branch is
+// taken. Instructions only run when all of them are.
+func executing(branches []bool) bool {
+	for _, taken := range branches {
+		if !taken {
+			return false
+		}
+	}
+	return true
+}
+
+func isConditional(instruction string) bool {
+	switch instruction {
+	case "OPIf", "OPNotIf", "OPElse", "OPEndIf":
+		return true
+	}
+	return false
+}
+
+// evalConditional updates branches for a conditional opcode. ParseScript
+// already checked that they are properly nested.
+func evalConditional(s *stack.Stack, branches []bool, instruction string) ([]bool, error) {
+	switch instruction {
+	case "OPIf", "OPNotIf":
+		taken := false
+		if executing(branches) {
+			items, err := pop(s, 1)
+			if err != nil {
+				return branches, err
+			}
+			taken = IsTruthy(items[0]) == (instruction == "OPIf")
+		}
+		return append(branches, taken), nil
+	case "OPElse":
+		branches[len(branches)-1] = !branches[len(branches)-1]
+	case "OPEndIf":
+		branches = branches[:len(branches)-1]
+	}
+
+	return branches, nil
+}
+
+// IsTruthy reports whether a stack element counts as true: it is non empty
+// and not only made of zeros, optionally negative or with a decimal point,
+// so that every encoding of the number zero is false.
+func IsTruthy(element string) bool {
+	return strings.Trim(strings.TrimPrefix(element, "-"), "0.") != ""
+}
+
+// checkStack runs after every instruction, each of which pushes at most one
+// element, so only the top of the stack can have grown too large.
+func checkStack(s *stack.Stack) error {
+	if s.Len() > MaxStackSize {
+		return fmt.Errorf("%w: more than %d items", ErrStackOverflow, MaxStackSize)
+	}
+
+	if top, err := s.Top(); err == nil && len(top) > MaxElementSize {
+		return fmt.Errorf("%w: %d > %d bytes", ErrElementTooLarge, len(top), MaxElementSize)
+	}
+
+	return nil
+}
+
+func evalInstruction(s *stack.Stack, instruction string, ctx Context) error {
+	switch instruction {
+	case "OPDup":
+		items, err := pop(s, 1)
+		if err != nil {
+			return err
+		}
+		arg, ok := ctx.Args[items[0]]
+		if !ok {
+			return fmt.Errorf("%w: %q", ErrMissingArg, items[0])
+		}
+		s.Push(arg)
+	case "OPHash", "OPSha256d", "OPRipemd160", "OPHash160", "OPHash3":
+		items, err := pop(s, 1)
+		if err != nil {
+			return err
+		}
+		s.Push(hashFuncs[instruction](items[0]))
+	case "OPEqualVerify":
+		items, err := pop(s, 2)
+		if err != nil {
+			return err
+		}
+		if !OPEqualVerify(items[0], items[1]) {
+			return ErrVerifyFailed
+		}
+	case "OPEqual":
+		items, err := pop(s, 2)
+		if err != nil {
+			return err
+		}
+		s.Push(boolElement(OPEqualVerify(items[0], items[1])))
+	case "OPVerify":
+		items, err := pop(s, 1)
+		if err != nil {
+			return err
+		}
+		if !IsTruthy(items[0]) {
+			return ErrVerifyFailed
+		}
+	case "OPNot":
+		items, err := pop(s, 1)
+		if err != nil {
+			return err
+		}
+		s.Push(boolElement(!IsTruthy(items[0])))
+	case "OPDrop":
+		if _, err := pop(s, 1); err != nil {
+			return err
+		}
+	case "OPNip", "OPSwap", "OPOver", "OPTuck", "OPRot":
+		return evalStackOp(s, instruction)
+	case "OPPick", "OPRoll":
+		items, err := pop(s, 1)
+		if err != nil {
+			return err
+		}
+		n, err := strconv.Atoi(items[0])
+		if err != nil || n < 0 {
+			return fmt.Errorf("%w: stack index %q", ErrBadEncoding, items[0])
+		}
+		if n >= s.Len() {
+			return fmt.Errorf("%w: no element at index %d", ErrStackUnderflow, n)
+		}
 
-	for _, instruction := range instructions {
-		switch instruction {
-		case "OPDup":
-			s.Push(args[s.Pop()])
-		case "OPHash":
-			s.Push(OPHash(s.Pop()))
-		case "OPEqualVerify":
-			if !OPEqualVerify(s.Pop(), s.Pop()) {
-				return false
+		// items holds the top n+1 elements, the picked one last.
+		items, err = pop(s, n+1)
+		if err != nil {
+			return err
+		}
+		picked := items[n]
+		if instruction == "OPPick" {
+			s.Push(picked)
+		}
+		for i := n - 1; i >= 0; i-- {
+			s.Push(items[i])
+		}
+		s.Push(picked)
+	case "OPDepth":
+		s.Push(strconv.Itoa(s.Len()))
+	case "OPAdd", "OPSub", "OPMin", "OPMax", "OPNumEqual",
+		"OPLessThan", "OPGreaterThan", "OPLessThanOrEqual", "OPGreaterThanOrEqual":
+		items, err := pop(s, 2)
+		if err != nil {
+			return err
+		}
+		res, err := evalNumeric(instruction, items[1], items[0])
+		if err != nil {
+			return err
+		}
+		s.Push(res)
+	// Pushes whether min <= x < max for x min max.
+	case "OPWithin":
+		items, err := pop(s, 3)
+		if err != nil {
+			return err
+		}
+		numbers, err := parseNumbers(items[2], items[1], items[0])
+		if err != nil {
+			return err
+		}
+		s.Push(boolElement(numbers[0].Cmp(numbers[1]) >= 0 && numbers[0].Cmp(numbers[2]) < 0))
+	// Pops the timestamp, field, station and oracle key written in the script
+	// then the value and signature supplied by the spender, and pushes the
+	// attested value.
+	case "OPCheckThirdParty":
+		items, err := pop(s, 4)
+		if err != nil {
+			return err
+		}
+		if err := OPCheckThirdParty(items[1], items[0], items[2], items[3]); err != nil {
+			return err
+		}
+		s.Push(items[2])
+	case "OPCheckSig":
+		items, err := pop(s, 2)
+		if err != nil {
+			return err
+		}
+		err = CheckSignature(items[0], items[1], ctx)
+		if err != nil && !errors.Is(err, ErrBadSignature) {
+			return err
+		}
+		s.Push(boolElement(err == nil))
+	case "OPCheckSigVerify":
+		items, err := pop(s, 2)
+		if err != nil {
+			return err
+		}
+		return CheckSignature(items[0], items[1], ctx)
+	case "OPCheckMultiSig":
+		ok, err := checkMultiSig(s, ctx)
+		if err != nil {
+			return err
+		}
+		s.Push(boolElement(ok))
+	case "OPCheckMultiSigVerify":
+		ok, err := checkMultiSig(s, ctx)
+		if err != nil {
+			return err
+		}
+		if !ok {
+			return ErrBadSignature
+		}
+	// The lock time opcodes leave their operand on the stack.
+	case "OPCheckLockTimeVerify":
+		top, err := s.Top()
+		if err != nil {
+			return ErrStackUnderflow
+		}
+		return OPCheckLockTimeVerify(top, ctx.LockTime)
+	case "OPCheckSequenceVerify":
+		top, err := s.Top()
+		if err != nil {
+			return ErrStackUnderflow
+		}
+		return OPCheckSequenceVerify(top, ctx.Sequence)
+	default:
+		return ErrUnknownOpcode
+	}
+
+	return nil
+}
+
+// checkMultiSig pops "sig1 ... sigm m key1 ... keyn n" and reports whether
+// every signature matches one of the keys. Signatures must be in the same
+// order as their keys, so each key is tried at most once.
+func checkMultiSig(s *stack.Stack, ctx Context) (bool, error) {
+	keys, err := popCounted(s, MaxMultiSigKeys)
+	if err != nil {
+		return false, err
+	}
+	signatures, err := popCounted(s, len(keys))
+	if err != nil {
+		return false, err
+	}
+
+	k := 0
+	for i, signature := range signatures {
+		for {
+			// Not enough keys left for the remaining signatures.
+			if len(keys)-k < len(signatures)-i {
+				return false, nil
 			}
-		case "OPCheckThirdParty":
-			if !OPCheckThirdParty(s.Pop(), s.Pop(), s.Pop()) {
-				return false
+
+			err := CheckSignature(keys[k], signature, ctx)
+			k++
+			if err == nil {
+				break
 			}
-		case "OPCheckSig":
-			if !OPCheckSig(s.Pop(), s.Pop(), s.Pop()) {
-				return false
+			if !errors.Is(err, ErrBadSignature) {
+				return false, err
 			}
-		default:
-			s.Push(instruction)
 		}
 	}
 
-	return true
+	return true, nil
+}
+
+// popCounted pops a count of at most max then that many elements, returned
+// in the order they were pushed.
+func popCounted(s *stack.Stack, max int) ([]string, error) {
+	items, err := pop(s, 1)
+	if err != nil {
+		return nil, err
+	}
+	n, err := strconv.Atoi(items[0])
+	if err != nil || n < 0 || n > max {
+		return nil, fmt.Errorf("%w: count %q not between 0 and %d", ErrBadEncoding, items[0], max)
+	}
+
+	items, err = pop(s, n)
+	if err != nil {
+		return nil, err
+	}
+	for i, j := 0, len(items)-1; i < j; i, j = i+1, j-1 {
+		items[i], items[j] = items[j], items[i]
+	}
+
+	return items, nil
+}
+
+// evalStackOp rearranges the top elements like the Bitcoin opcodes of the
+// same name, e.g. OPRot turns "a b c" into "b c a".
+func evalStackOp(s *stack.Stack, instruction string) error {
+	n := 2
+	if instruction == "OPRot" {
+		n = 3
+	}
+
+	items, err := pop(s, n)
+	if err != nil {
+		return err
+	}
+	top, second := items[0], items[1]
+
+	switch instruction {
+	case "OPNip":
+		s.Push(top)
+	case "OPSwap":
+		s.Push(top, second)
+	case "OPOver":
+		s.Push(second, top, second)
+	case "OPTuck":
+		s.Push(top, second, top)
+	case "OPRot":
+		s.Push(second, top, items[2])
+	}
+
+	return nil
+}
+
+// pop removes n items from s, the top of the stack first.
+func pop(s *stack.Stack, n int) ([]string, error) {
+	items := make([]string, n)
+	for i := range items {
+		item, err := s.Pop()
+		if err != nil {
+			return nil, fmt.Errorf("%w: %d items needed", ErrStackUnderflow, n)
+		}
+		items[i] = item
+	}
+
+	return items, nil
+}
+
+func boolElement(b bool) string {
+	if b {
+		return "1"
+	}
+	return "0"
+}
+
+var hashFuncs = map[string]func(string) string{
+	"OPHash":      OPHash,
+	"OPSha256d":   OPSha256d,
+	"OPRipemd160": OPRipemd160,
+	"OPHash160":   OPHash160,
+	"OPHash3":     OPHash3,
 }
 
 func OPHash(input string) string {
@@ -74,46 +569,96 @@ func OPEqualVerify(input1, input2 string) bool {
 }
 
 func OPCheckSig(pubKey string, hash string, signature string) bool {
-	pDec, errDec := base64.StdEncoding.DecodeString(pubKey)
-	if errDec != nil {
-		log.Fatal(errDec)
-	}
-
-	pemKey, _ := pem.Decode(pDec)
-
-	rsaKey, errParse := x509.ParsePKIXPublicKey(pemKey.Bytes)
-	if errParse != nil {
-		log.Fatal(errParse)
-	}
-
 	sDec, errDecSig := base64.StdEncoding.DecodeString(signature)
 	if errDecSig != nil {
-		log.Fatal(errDecSig)
+		return false
 	}
 
 	hexHash, errDecode := hex.DecodeString(hash)
 	if errDecode != nil {
 		return false
 	}
-	err := rsa.VerifyPKCS1v15(rsaKey.(*rsa.PublicKey), crypto.SHA256, hexHash, sDec)
+
+	return verifySignature(pubKey, hexHash, sDec) == nil
+}
+
+// CheckSignature verifies signature against the digest of the spending
+// transaction selected by its trailing hash type byte.
+func CheckSignature(pubKey string, signature string, ctx Context) error {
+	sDec, err := base64.StdEncoding.DecodeString(signature)
 	if err != nil {
-		return false
+		return fmt.Errorf("%w: signature: %v", ErrBadEncoding, err)
 	}
-	return true
+	if len(sDec) < 2 {
+		return fmt.Errorf("%w: signature too short", ErrBadEncoding)
+	}
+
+	hashType := sDec[len(sDec)-1]
+	if !ValidSigHashType(hashType) {
+		return fmt.Errorf("%w: %#x", ErrUnknownSigHashType, hashType)
+	}
+	if ctx.SigHash == nil {
+		return ErrNoTransaction
+	}
+
+	digest, err := ctx.SigHash(hashType)
+	if err != nil {
+		return err
+	}
+
+	return verifySignature(pubKey, digest, sDec[:len(sDec)-1])
 }
 
-func OPCheckThirdParty(url string, finalField string, expectedValue string) bool {
-	res, err := http.Get(url)
+func OPCheckLockTimeVerify(input string, lockTime int64) error {
+	required, err := strconv.ParseInt(input, 10, 64)
+	if err != nil || required < 0 {
+		return fmt.Errorf("%w: lock time %q", ErrBadEncoding, input)
+	}
+
+	if (required < LockTimeThreshold) != (lockTime < LockTimeThreshold) {
+		return fmt.Errorf("%w: %d and %d are not both heights or times", ErrUnsatisfiedLockTime, required, lockTime)
+	}
+	if required > lockTime {
+		return fmt.Errorf("%w: %d > %d", ErrUnsatisfiedLockTime, required, lockTime)
+	}
+
+	return nil
+}
+
+func OPCheckSequenceVerify(input string, sequence uint32) error {
+	parsed, err := strconv.ParseUint(input, 10, 32)
 	if err != nil {
-		return false
+		return fmt.Errorf("%w: sequence %q", ErrBadEncoding, input)
 	}
-	defer res.Body.Close()
+	required := uint32(parsed)
 
-	body, err := io.ReadAll(res.Body)
+	if required&SequenceLockTimeDisableFlag != 0 {
+		return nil
+	}
+	if sequence&SequenceLockTimeDisableFlag != 0 {
+		return fmt.Errorf("%w: relative lock time disabled by sequence", ErrUnsatisfiedLockTime)
+	}
+	if required&SequenceLockTimeTypeFlag != sequence&SequenceLockTimeTypeFlag {
+		return fmt.Errorf("%w: %#x and %#x are not both blocks or time", ErrUnsatisfiedLockTime, required, sequence)
+	}
+	if required&SequenceLockTimeMask > sequence&SequenceLockTimeMask {
+		return fmt.Errorf("%w: %d > %d", ErrUnsatisfiedLockTime, required&SequenceLockTimeMask, sequence&SequenceLockTimeMask)
+	}
+
+	return nil
+}
+
+// OPCheckThirdParty verifies that the oracle with pubKey signed value for
+// the attestation with id. Attestations travel in the spending transaction,
+// so validation never depends on reaching the oracle.
+func OPCheckThirdParty(pubKey, id, value, signature string) error {
+	err := oracle.Verify(pubKey, id, value, signature)
+	if errors.Is(err, oracle.ErrBadKey) {
+		return fmt.Errorf("%w: %w", ErrBadEncoding, err)
+	}
 	if err != nil {
-		return false
+		return fmt.Errorf("%w: %w", ErrVerifyFailed, err)
 	}
-	r := gjson.Get(string(body), finalField).String()
 
-	return r == expectedValue
+	return nil
 }
@@ -2,25 +2,30 @@ package script_test
 
 import (
 	"crypto"
+	"crypto/ed25519"
+	"crypto/rand"
 	"crypto/rsa"
 	"crypto/sha256"
 	"crypto/x509"
 	"encoding/base64"
 	"encoding/hex"
 	"encoding/pem"
+	"errors"
+	"oracle"
 	"script"
+	"strings"
 	"testing"
 )
 
 func TestOPHashEqualSucces(t *testing.T) {
 	message := "test"
 	hash := script.OPHash(message)
-	s := "message --- message OPDup OPHash " + hash + " OPEqualVerify"
+	s := "message --- message OPDup OPHash " + hash + " OPEqual"
 	evalArgs := map[string]string{"message": message}
-	evalRes := script.EvalScript(s, evalArgs)
+	err := script.EvalScript(s, script.Context{Args: evalArgs})
 
-	if !evalRes {
-		t.Fatalf(`Got %v, expected true`, evalRes)
+	if err != nil {
+		t.Fatalf(`Got %v, expected nil`, err)
 	}
 }
 
@@ -134,3 +139,399 @@ iQIDAQAB
 		t.Fatalf("Got %v, expected false", ok)
 	}
 }
+
+func TestOPCheckLockTimeVerify(t *testing.T) {
+	s := "--- 100 OPCheckLockTimeVerify"
+
+	if err := script.EvalScript(s, script.Context{LockTime: 99}); !errors.Is(err, script.ErrUnsatisfiedLockTime) {
+		t.Fatalf("Got %v, expected ErrUnsatisfiedLockTime for lock time 99", err)
+	}
+	if err := script.EvalScript(s, script.Context{LockTime: 100}); err != nil {
+		t.Fatalf("Got %v, expected nil for lock time 100", err)
+	}
+	if err := script.EvalScript(s, script.Context{LockTime: script.LockTimeThreshold + 100}); !errors.Is(err, script.ErrUnsatisfiedLockTime) {
+		t.Fatalf("Got %v, expected ErrUnsatisfiedLockTime when mixing heights and timestamps", err)
+	}
+}
+
+func TestOPCheckSequenceVerify(t *testing.T) {
+	s := "--- 10 OPCheckSequenceVerify"
+
+	if err := script.EvalScript(s, script.Context{Sequence: 9}); !errors.Is(err, script.ErrUnsatisfiedLockTime) {
+		t.Fatalf("Got %v, expected ErrUnsatisfiedLockTime for sequence 9", err)
+	}
+	if err := script.EvalScript(s, script.Context{Sequence: 10}); err != nil {
+		t.Fatalf("Got %v, expected nil for sequence 10", err)
+	}
+	if err := script.EvalScript(s, script.Context{Sequence: script.SequenceLockTimeDisableFlag | 10}); !errors.Is(err, script.ErrUnsatisfiedLockTime) {
+		t.Fatalf("Got %v, expected ErrUnsatisfiedLockTime for disabled relative lock", err)
+	}
+	if err := script.EvalScript(s, script.Context{Sequence: script.SequenceLockTimeTypeFlag | 10}); !errors.Is(err, script.ErrUnsatisfiedLockTime) {
+		t.Fatalf("Got %v, expected ErrUnsatisfiedLockTime when mixing blocks and time", err)
+	}
+}
+
+func TestOPCheckSigCommitsToSigHash(t *testing.T) {
+	key := newRSASigners(t, 1)[0]
+
+	digests := map[byte][32]byte{
+		script.SigHashAll:  sha256.Sum256([]byte("all")),
+		script.SigHashNone: sha256.Sum256([]byte("none")),
+	}
+	ctx := script.Context{
+		SigHash: func(hashType byte) ([]byte, error) {
+			digest, ok := digests[hashType]
+			if !ok {
+				return nil, errors.New("unexpected hash type")
+			}
+			return digest[:], nil
+		},
+	}
+
+	digest := digests[script.SigHashAll]
+	signed := decodeSignature(key.sign(digest[:]))
+	s := "--- sign OPDup pubKey OPDup OPCheckSig"
+
+	ctx.Args = map[string]string{"pubKey": key.pubKey, "sign": script.EncodeSignature(signed, script.SigHashAll)}
+	if err := script.EvalScript(s, ctx); err != nil {
+		t.Fatalf("Got %v, expected a SIGHASH_ALL signature to verify", err)
+	}
+
+	// The same signature claiming another hash type signs a different digest.
+	ctx.Args["sign"] = script.EncodeSignature(signed, script.SigHashNone)
+	if err := script.EvalScript(s, ctx); !errors.Is(err, script.ErrEvalFalse) {
+		t.Fatalf("Got %v, expected ErrEvalFalse for SIGHASH_NONE", err)
+	}
+	if err := script.EvalScript(s+"Verify 1", ctx); !errors.Is(err, script.ErrBadSignature) {
+		t.Fatalf("Got %v, expected OPCheckSigVerify to fail with ErrBadSignature", err)
+	}
+
+	ctx.Args["sign"] = script.EncodeSignature(signed, 0x04)
+	if err := script.EvalScript(s, ctx); !errors.Is(err, script.ErrUnknownSigHashType) {
+		t.Fatalf("Got %v, expected ErrUnknownSigHashType", err)
+	}
+}
+
+func TestEvalScriptErrors(t *testing.T) {
+	hash := script.OPHash("test")
+	tests := []struct {
+		script string
+		args   map[string]string
+		err    error
+		index  int
+	}{
+		{"--- " + hash + " OPEqualVerify", nil, script.ErrStackUnderflow, 1},
+		{"message --- message OPDup", nil, script.ErrMissingArg, 1},
+		{"message --- message OPDup OPHash test OPEqualVerify", map[string]string{"message": "test"}, script.ErrVerifyFailed, 4},
+		{"--- pubKey sign OPCheckSig", nil, script.ErrBadEncoding, 2},
+	}
+
+	for _, test := range tests {
+		err := script.EvalScript(test.script, script.Context{Args: test.args})
+		if !errors.Is(err, test.err) {
+			t.Fatalf("EvalScript(%q) == %v, expected %v", test.script, err, test.err)
+		}
+
+		var evalErr *script.EvalError
+		if !errors.As(err, &evalErr) || evalErr.Index != test.index {
+			t.Fatalf("EvalScript(%q) == %v, expected failure at instruction %d", test.script, err, test.index)
+		}
+	}
+}
+
+func TestOPCheckSigMalformedInput(t *testing.T) {
+	// Used to log.Fatal and take the whole node down.
+	if script.OPCheckSig("not base64!", "00", "c2ln") {
+		t.Fatalf("Got true, expected false for a malformed public key")
+	}
+	if script.OPCheckSig(base64.StdEncoding.EncodeToString([]byte("not pem")), "00", "c2ln") {
+		t.Fatalf("Got true, expected false for a public key that is not PEM")
+	}
+}
+
+func TestEvalScriptFinalStack(t *testing.T) {
+	tests := map[string]error{
+		"--- test test OPEqual":         nil,
+		"--- test other OPEqual":        script.ErrEvalFalse,
+		"--- test test OPEqualVerify":   script.ErrEvalFalse,
+		"--- test test OPEqualVerify 0": script.ErrEvalFalse,
+		"--- -00":                       script.ErrEvalFalse,
+		"":                              script.ErrEvalFalse,
+	}
+
+	for s, expected := range tests {
+		if err := script.EvalScript(s, script.Context{}); !errors.Is(err, expected) {
+			t.Fatalf("EvalScript(%q) == %v, expected %v", s, err, expected)
+		}
+	}
+}
+
+func TestEvalScriptLimits(t *testing.T) {
+	tests := []struct {
+		name   string
+		script string
+		err    error
+	}{
+		{"script size", "--- " + strings.Repeat("a ", script.MaxScriptSize/2), script.ErrScriptTooLarge},
+		{"ops", "--- a" + strings.Repeat(" OPHash", script.MaxOps+1), script.ErrTooManyOps},
+		{"stack size", "---" + strings.Repeat(" 1", script.MaxStackSize+1), script.ErrStackOverflow},
+		{"element size", "--- " + strings.Repeat("a", script.MaxElementSize+1), script.ErrElementTooLarge},
+	}
+
+	for _, test := range tests {
+		if err := script.EvalScript(test.script, script.Context{}); !errors.Is(err, test.err) {
+			t.Fatalf("%s: Got %v, expected %v", test.name, err, test.err)
+		}
+	}
+
+	// Scripts right at the limits still run.
+	atLimits := []string{
+		"--- a" + strings.Repeat(" OPHash", script.MaxOps),
+		"---" + strings.Repeat(" 1", script.MaxStackSize),
+		"--- " + strings.Repeat("a", script.MaxElementSize),
+	}
+	for _, s := range atLimits {
+		if err := script.EvalScript(s, script.Context{}); err != nil {
+			t.Fatalf("Got %v, expected a script at the limit to succeed", err)
+		}
+	}
+}
+
+func TestEvalScriptElementFromArgsTooLarge(t *testing.T) {
+	args := map[string]string{"message": strings.Repeat("a", script.MaxElementSize+1)}
+
+	err := script.EvalScript("message --- message OPDup", script.Context{Args: args})
+	if !errors.Is(err, script.ErrElementTooLarge) {
+		t.Fatalf("Got %v, expected ErrElementTooLarge", err)
+	}
+}
+
+func TestOPCheckThirdPartyOracle(t *testing.T) {
+	_, key, _ := ed25519.GenerateKey(rand.Reader)
+	o := oracle.New(key, oracle.NewMemoryStore())
+
+	attestation, err := o.Attest(oracle.Observation{Station: "LFPG", Field: "temperature", Value: "21", Timestamp: 1700000000})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	s := "sig value --- sig OPDup value OPDup " + o.PublicKey() + " " + attestation.ID() + " OPCheckThirdParty 21 OPEqual"
+	args := map[string]string{"sig": attestation.Signature, "value": attestation.Value}
+	if err := script.EvalScript(s, script.Context{Args: args}); err != nil {
+		t.Fatalf("Got %v, expected the attestation to unlock the script", err)
+	}
+
+	args["value"] = "35"
+	if err := script.EvalScript(s, script.Context{Args: args}); !errors.Is(err, script.ErrVerifyFailed) {
+		t.Fatalf("Got %v, expected ErrVerifyFailed for a value the oracle did not sign", err)
+	}
+
+	args["value"] = "21"
+	other := strings.Replace(s, attestation.ID(), oracle.ObservationID(o.PublicKey(), "LFPG", "temperature", 1700003600), 1)
+	if err := script.EvalScript(other, script.Context{Args: args}); !errors.Is(err, script.ErrVerifyFailed) {
+		t.Fatalf("Got %v, expected ErrVerifyFailed for another timestamp", err)
+	}
+}
+
+func TestEvalScriptConditionals(t *testing.T) {
+	tests := map[string]error{
+		"--- 1 OPIf ok OPElse 0 OPEndIf":                         nil,
+		"--- 0 OPIf ok OPElse 0 OPEndIf":                         script.ErrEvalFalse,
+		"--- 0 OPIf OPVerify OPElse ok OPEndIf":                  nil,
+		"--- 1 0 OPIf 0 OPElse OPIf ok OPEndIf OPEndIf":          nil,
+		"--- 0 OPIf 1 OPIf 0 OPElse 0 OPEndIf OPElse ok OPEndIf": nil,
+		"--- 1 OPIf ok":       script.ErrUnbalancedIf,
+		"--- ok OPEndIf":      script.ErrUnbalancedIf,
+		"--- OPIf ok OPEndIf": script.ErrStackUnderflow,
+	}
+
+	for s, expected := range tests {
+		if err := script.EvalScript(s, script.Context{}); !errors.Is(err, expected) {
+			t.Fatalf("EvalScript(%q) == %v, expected %v", s, err, expected)
+		}
+	}
+}
+
+func TestEvalScriptNumericComparisons(t *testing.T) {
+	tests := map[string]error{
+		"--- 21 20 OPGreaterThan":                nil,
+		"--- 20 20 OPGreaterThan":                script.ErrEvalFalse,
+		"--- -0.5 -1 OPGreaterThan":              nil,
+		"--- 0.4 0 OPGreaterThan OPVerify 1":     nil,
+		"--- 0 0 OPGreaterThan OPVerify 1":       script.ErrVerifyFailed,
+		"--- 15 15 20 OPWithin":                  nil,
+		"--- 20 15 20 OPWithin":                  script.ErrEvalFalse,
+		"--- 1e3 0 OPGreaterThan":                script.ErrBadEncoding,
+		"--- 1 2 OPDrop":                         nil,
+		"--- 1/3 0 OPGreaterThan":                script.ErrBadEncoding,
+		"--- 19.99 15 20 OPWithin OPVerify 20.5": nil,
+	}
+
+	for s, expected := range tests {
+		if err := script.EvalScript(s, script.Context{}); !errors.Is(err, expected) {
+			t.Fatalf("EvalScript(%q) == %v, expected %v", s, err, expected)
+		}
+	}
+}
+
+func TestParseScriptNesting(t *testing.T) {
+	tests := map[string]error{
+		"--- 1 OPIf a OPElse b OPEndIf":                   nil,
+		"--- 1 OPNotIf 1 OPIf a OPEndIf OPElse b OPEndIf": nil,
+		"--- 1 OPIf a":                           script.ErrUnbalancedIf,
+		"--- a OPEndIf":                          script.ErrUnbalancedIf,
+		"--- a OPElse":                           script.ErrUnbalancedIf,
+		"--- 1 OPIf a OPElse b OPElse c OPEndIf": script.ErrUnbalancedIf,
+	}
+
+	for s, expected := range tests {
+		if _, _, err := script.ParseScript(s); !errors.Is(err, expected) {
+			t.Fatalf("ParseScript(%q) == %v, expected %v", s, err, expected)
+		}
+	}
+
+	// Nesting is checked before running anything, even unreachable code.
+	if err := script.EvalScript("--- 0 OPVerify OPEndIf", script.Context{}); !errors.Is(err, script.ErrUnbalancedIf) {
+		t.Fatalf("Got %v, expected ErrUnbalancedIf", err)
+	}
+}
+
+func TestEvalScriptStackOps(t *testing.T) {
+	tests := map[string]string{
+		"--- 0 OPNot":              "1",
+		"--- a OPNot":              "0",
+		"--- 0 OPNotIf a OPEndIf":  "a",
+		"--- a b OPDrop":           "a",
+		"--- a b OPNip OPDepth":    "1",
+		"--- a b OPSwap":           "a",
+		"--- a b OPOver":           "a",
+		"--- a b OPTuck OPDepth":   "3",
+		"--- a b c OPRot":          "a",
+		"--- a b c 2 OPPick":       "a",
+		"--- a b c 0 OPPick":       "c",
+		"--- a b c 1 OPRoll":       "b",
+		"--- a b c 1 OPRoll OPNip": "b",
+		"--- a b c OPDepth":        "3",
+	}
+
+	for s, expected := range tests {
+		if err := script.EvalScript(s+" "+expected+" OPEqual", script.Context{}); err != nil {
+			t.Fatalf("EvalScript(%q) == %v, expected %s on top", s, err, expected)
+		}
+	}
+
+	// Check the whole stack after the rearranging ops.
+	full := map[string]string{
+		"--- a b OPSwap":       "b a",
+		"--- a b OPOver":       "a b a",
+		"--- a b OPTuck":       "b a b",
+		"--- a b c OPRot":      "b c a",
+		"--- a b c 2 OPPick":   "a b c a",
+		"--- a b c 2 OPRoll":   "b c a",
+		"--- a b c 1 OPRoll":   "a c b",
+		"--- a b c d 3 OPRoll": "b c d a",
+	}
+	for s, expected := range full {
+		elements := strings.Fields(expected)
+		check := ""
+		for i := len(elements) - 1; i >= 0; i-- {
+			check += " " + elements[i] + " OPEqualVerify"
+		}
+		if err := script.EvalScript(s+check+" OPDepth 0 OPEqual", script.Context{}); err != nil {
+			t.Fatalf("EvalScript(%q) == %v, expected stack %s", s, err, expected)
+		}
+	}
+
+	underflows := []string{"--- OPNot", "--- a OPSwap", "--- a OPOver", "--- a b OPRot", "--- a 1 OPPick", "--- a 5 OPRoll"}
+	for _, s := range underflows {
+		if err := script.EvalScript(s, script.Context{}); !errors.Is(err, script.ErrStackUnderflow) {
+			t.Fatalf("EvalScript(%q) == %v, expected ErrStackUnderflow", s, err)
+		}
+	}
+	if err := script.EvalScript("--- a -1 OPPick", script.Context{}); !errors.Is(err, script.ErrBadEncoding) {
+		t.Fatalf("Got %v, expected ErrBadEncoding for a negative index", err)
+	}
+}
+
+func TestTrace(t *testing.T) {
+	ctx := script.Context{Args: map[string]string{"value": "12.5"}}
+	steps, err := script.Trace("", "value --- value OPDup 20 OPGreaterThan OPIf win OPElse lose OPEndIf", ctx)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	expected := []struct {
+		instruction string
+		executed    bool
+		stack       string
+	}{
+		{"value", true, "value"},
+		{"OPDup", true, "12.5"},
+		{"20", true, "12.5 20"},
+		{"OPGreaterThan", true, "0"},
+		{"OPIf", true, ""},
+		{"win", false, ""},
+		{"OPElse", true, ""},
+		{"lose", true, "lose"},
+		{"OPEndIf", true, "lose"},
+	}
+	if len(steps) != len(expected) {
+		t.Fatalf("Got %d steps, expected %d", len(steps), len(expected))
+	}
+	for i, step := range steps {
+		if step.Index != i || step.Instruction != expected[i].instruction || step.Executed != expected[i].executed || strings.Join(step.Stack, " ") != expected[i].stack {
+			t.Fatalf("Step %d == %+v, expected %+v", i, step, expected[i])
+		}
+	}
+
+	// The trace stops before the failing instruction.
+	steps, err = script.Trace("", "--- 1 2 OPEqualVerify 1", script.Context{})
+	if !errors.Is(err, script.ErrVerifyFailed) || len(steps) != 2 || steps[1].Position != "1:7" {
+		t.Fatalf("Got %d steps and %v, expected 2 steps and ErrVerifyFailed", len(steps), err)
+	}
+
+	// Unlocking script pushes are traced before the locking script runs.
+	steps, err = script.Trace("a b", "--- OPSwap", script.Context{})
+	if err != nil || len(steps) != 3 {
+		t.Fatalf("Got %d steps and %v, expected 3 steps", len(steps), err)
+	}
+	if steps[1].Position != "sig" || steps[1].Instruction != "b" || strings.Join(steps[1].Stack, " ") != "a b" {
+		t.Fatalf("Step 1 == %+v, expected the push of b", steps[1])
+	}
+	if strings.Join(steps[2].Stack, " ") != "b a" {
+		t.Fatalf("Step 2 == %+v, expected the swapped stack", steps[2])
+	}
+}
+
+func TestVerifyScript(t *testing.T) {
+	key := newSchemeKeys(t)[script.SchemeEd25519]
+	lockingScript := script.PayToPubKeyHash(script.OPHash(key.pubKey))
+	signature := script.EncodeSignature(key.sign(multiSigDigest[:]), script.SigHashAll)
+	ctx := multiSigContext()
+
+	if err := script.VerifyScript(script.PubKeyHashSig(signature, key.pubKey), lockingScript, ctx); err != nil {
+		t.Fatalf("Got %v, expected the unlocking script to unlock", err)
+	}
+
+	other := newSchemeKeys(t)[script.SchemeEd25519]
+	otherSignature := script.EncodeSignature(other.sign(multiSigDigest[:]), script.SigHashAll)
+	tests := map[string]error{
+		script.PubKeyHashSig(otherSignature, other.pubKey): script.ErrVerifyFailed,
+		script.PubKeyHashSig(otherSignature, key.pubKey):   script.ErrEvalFalse,
+		key.pubKey: script.ErrStackUnderflow,
+		"":         script.ErrStackUnderflow,
+	}
+	for scriptSig, expected := range tests {
+		if err := script.VerifyScript(scriptSig, lockingScript, ctx); !errors.Is(err, expected) {
+			t.Fatalf("VerifyScript(%q) == %v, expected %v", scriptSig, err, expected)
+		}
+	}
+
+	// Unlocking scripts only push data, even tokens that read as opcodes.
+	if err := script.VerifyScript("OPVerify 0", "--- OPDrop", script.Context{}); err != nil {
+		t.Fatalf("Got %v, expected OPVerify to be pushed as data", err)
+	}
+	if err := script.VerifyScript(strings.Repeat("a", script.MaxElementSize+1), "--- 1", script.Context{}); !errors.Is(err, script.ErrElementTooLarge) {
+		t.Fatalf("Got %v, expected ErrElementTooLarge", err)
+	}
+}